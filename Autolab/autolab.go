@@ -2,15 +2,23 @@ package Autolab
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel"
 )
 
+// Does nothing unless the program sets up a tracer provider.
+var tracer = otel.Tracer("github.com/p5quared/decanter/Autolab")
+
 type Autolab struct {
 	c    *http.Client
 	host string
@@ -23,10 +31,23 @@ func NewAutolab(client *http.Client) Autolab {
 
 // These functions are used for user interaction with the Autolab API.
 func (a Autolab) GetAutolab(endpoint string, res interface{}) error {
-	resp, err := a.c.Get(endpoint)
+	return a.getAutolab(context.Background(), endpoint, res)
+}
+
+func (a Autolab) getAutolab(ctx context.Context, endpoint string, res interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return err
 	}
+	resp, err := a.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newStatusError(resp)
+	}
 	err = json.NewDecoder(resp.Body).Decode(res)
 	if err != nil {
 		return err
@@ -36,14 +57,28 @@ func (a Autolab) GetAutolab(endpoint string, res interface{}) error {
 
 // Get submissions for a single assessment
 func (a Autolab) GetSubmissions(course, assessment string) ([]SubmissionsResponse, error) {
+	return a.getSubmissions(context.Background(), course, assessment)
+}
+
+func (a Autolab) getSubmissions(ctx context.Context, course, assessment string) ([]SubmissionsResponse, error) {
 	var submissions []SubmissionsResponse
-	err := a.GetAutolab(UrlSubmissions(a.host, course, assessment), &submissions)
+	err := a.getAutolab(ctx, UrlSubmissions(a.host, course, assessment), &submissions)
 	if err != nil {
 		return nil, err
 	}
 	return submissions, nil
 }
 
+// Only works with instructor scopes.
+func (a Autolab) GetProblems(course, assessment string) ([]ProblemsResponse, error) {
+	var problems []ProblemsResponse
+	err := a.GetAutolab(UrlProblems(a.host, course, assessment), &problems)
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
+
 func (a Autolab) GetUserInfo() (UserResponse, error) {
 	var user UserResponse
 	err := a.GetAutolab(UrlUser(a.host), &user)
@@ -71,33 +106,95 @@ func (a Autolab) GetUserAssessments(course string) ([]AssessmentsResponse, error
 	return assessments, nil
 }
 
-func (a Autolab) PollLatestSubmission(course, assessment string, oldVersion int) (SubmissionsResponse, error) {
-	const timeout = 2 * time.Minute
-	const pollInterval = 10 * time.Second
-	for {
-		select {
-		case <-time.After(timeout):
-			// TODO: It would be nice to display time out vs error to user
-			return SubmissionsResponse{}, fmt.Errorf("timed out")
-		case <-time.Tick(pollInterval):
-			submissions, err := a.GetSubmissions(course, assessment)
-			if err != nil {
-				return SubmissionsResponse{}, err
-			}
-			if len(submissions) < 1 {
-				return SubmissionsResponse{}, fmt.Errorf("no submissions found")
-			}
+// How many times SubmitFile tries to upload.
+const submitAttempts = 3
+
+type SubmitOptions struct {
+	// Called as the file is uploaded, with the bytes sent so far and the
+	// file's size (-1 if unknown). Starts over if the upload is retried.
+	OnProgress func(sent, total int64)
+}
+
+// POSTs are never retried blindly: if an upload fails in a way that
+// might have reached the server, we check the submissions list first
+// and only upload again if no new version showed up.
+func (a Autolab) SubmitFile(course, assmnt, fName string, opts SubmitOptions) (SubmitResponse, error) {
+	// Remember the latest version so we can tell whether a failed upload went through.
+	before, err := a.GetSubmissions(course, assmnt)
+	if err != nil {
+		return SubmitResponse{}, err
+	}
+	latest := latestVersion(before)
+	started := time.Now()
+
+	var lastErr error
+	for attempt := 0; attempt < submitAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+
+		submitResp, err := a.submitOnce(course, assmnt, fName, opts.OnProgress)
+		if err == nil {
+			return submitResp, nil
+		}
+		if !isTransient(err) {
+			return SubmitResponse{}, err
+		}
+		lastErr = err
 
-			for _, sub := range submissions {
-				if sub.Version > oldVersion && sub.Scores != nil && len(sub.Scores) > 0 {
-					return sub, nil
-				}
+		after, err := a.GetSubmissions(course, assmnt)
+		if err != nil {
+			return SubmitResponse{}, fmt.Errorf("%w: upload failed (%v), then checking failed (%v)", ErrSubmitUnconfirmed, lastErr, err)
+		}
+		if latestVersion(after) > latest {
+			// Something arrived, but it could be a teammate's or another
+			// terminal's; only claim it if it's our file, made since we started.
+			if sub, ok := FindUpload(after, fName, started); ok && sub.Version > latest {
+				return SubmitResponse{Version: sub.Version, Filename: sub.Filename}, nil
 			}
+			return SubmitResponse{}, fmt.Errorf("%w: upload failed (%v), and someone else has submitted since", ErrSubmitUnconfirmed, lastErr)
+		}
+	}
+	return SubmitResponse{}, fmt.Errorf("gave up after %d attempts: %w", submitAttempts, lastErr)
+}
+
+// Our clock and Autolab's won't agree exactly.
+const clockSkew = time.Minute
+
+// The newest submission of fName made since since.
+// Autolab prefixes uploads with the user and version,
+// i.e. "me@buffalo.edu_3_handin.tar", so match on the suffix.
+func FindUpload(submissions []SubmissionsResponse, fName string, since time.Time) (SubmissionsResponse, bool) {
+	var found SubmissionsResponse
+	for _, sub := range submissions {
+		if !strings.HasSuffix(sub.Filename, filepath.Base(fName)) {
+			continue
+		}
+		// Can't tell when it was made, so we can't claim it.
+		submitted, err := ParseTime(sub.Submitted)
+		if err != nil || submitted.Before(since.Add(-clockSkew)) {
+			continue
+		}
+		if sub.Version > found.Version {
+			found = sub
 		}
 	}
+	return found, found.Version > 0
 }
 
-func (a Autolab) SubmitFile(course, assmnt, fName string) (SubmitResponse, error) {
+func latestVersion(submissions []SubmissionsResponse) int {
+	var latest int
+	for _, sub := range submissions {
+		latest = max(latest, sub.Version)
+	}
+	return latest
+}
+
+const submitField = "submission[file]"
+
+// The file is streamed straight into the request rather than
+// read into memory first, since handins can be large.
+func (a Autolab) submitOnce(course, assmnt, fName string, onProgress func(sent, total int64)) (SubmitResponse, error) {
 	endpoint := UrlSubmit(a.host, course, assmnt)
 
 	file, err := os.Open(fName)
@@ -106,40 +203,49 @@ func (a Autolab) SubmitFile(course, assmnt, fName string) (SubmitResponse, error
 	}
 	defer file.Close()
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile("submission[file]", fName)
-	if err != nil {
-		return SubmitResponse{}, err
+	size := int64(-1)
+	if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+		size = info.Size()
 	}
-	_, err = io.Copy(part, file)
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		var src io.Reader = file
+		if onProgress != nil {
+			onProgress(0, size)
+			src = &progressReader{r: file, total: size, onProgress: onProgress}
+		}
+		part, err := writer.CreateFormFile(submitField, fName)
+		if err == nil {
+			_, err = io.Copy(part, src)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest("POST", endpoint, pr)
 	if err != nil {
+		pr.Close()
 		return SubmitResponse{}, err
 	}
-	err = writer.Close()
-	if err != nil {
-		return SubmitResponse{}, err
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if size >= 0 {
+		req.ContentLength = multipartLength(writer.Boundary(), fName, size)
 	}
 
-	req, err := http.NewRequest("POST", endpoint, body)
+	resp, err := a.c.Do(req)
+	// Stops the writer if the request failed before reading everything.
+	pr.Close()
 	if err != nil {
 		return SubmitResponse{}, err
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	defer resp.Body.Close()
 
-	resp, err := a.c.Do(req)
 	if resp.StatusCode != http.StatusOK {
-		var respError struct {
-			Error string `json:"error"`
-		}
-		err = json.NewDecoder(resp.Body).Decode(&respError)
-		if err != nil {
-			return SubmitResponse{}, err
-		}
-		return SubmitResponse{}, fmt.Errorf("unexpected status code: %d, error: %s", resp.StatusCode, respError.Error)
-	}
-	if err != nil {
-		return SubmitResponse{}, err
+		return SubmitResponse{}, newStatusError(resp)
 	}
 
 	var submitResp SubmitResponse
@@ -149,3 +255,30 @@ func (a Autolab) SubmitFile(course, assmnt, fName string) (SubmitResponse, error
 	}
 	return submitResp, nil
 }
+
+// Size of the multipart body for a file of size bytes,
+// found by writing the framing around an empty file.
+func multipartLength(boundary, fName string, size int64) int64 {
+	var framing bytes.Buffer
+	w := multipart.NewWriter(&framing)
+	w.SetBoundary(boundary)
+	w.CreateFormFile(submitField, fName)
+	w.Close()
+	return int64(framing.Len()) + size
+}
+
+type progressReader struct {
+	r          io.Reader
+	sent       int64
+	total      int64
+	onProgress func(sent, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.onProgress(p.sent, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,97 @@
+package Autolab
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"golang.org/x/oauth2"
+)
+
+// Returned when Autolab responds with anything other than 200.
+type StatusError struct {
+	Code int
+	// From the {"error": "..."} body, if there was one.
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.Code)
+	}
+	return fmt.Sprintf("unexpected status code: %d, error: %s", e.Code, e.Message)
+}
+
+// Worth trying again later (rate limited or the server is struggling).
+func (e *StatusError) Temporary() bool {
+	switch e.Code {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	var respError struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&respError)
+	return &StatusError{Code: resp.StatusCode, Message: respError.Error}
+}
+
+// The upload failed, and we couldn't tell whether Autolab got it.
+var ErrSubmitUnconfirmed = errors.New("submission may or may not have gone through")
+
+// Whether a request might succeed if tried again: a transient status,
+// or the network letting us down. Anything else (the file can't be
+// read, a bad response) will fail the same way next time.
+func isTransient(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+	// A refresh the server turned down won't go any better.
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return false
+	}
+	return IsNetworkError(err)
+}
+
+// Whether err is the connection failing: a dropped or reset connection,
+// or a timeout. The client wraps everything in a *url.Error, so it's
+// the cause that counts; a file that can't be read or a certificate we
+// don't trust will fail the same way next time.
+func IsNetworkError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &certErr) || errors.As(err, &recordErr) {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		// The server sent a TLS alert, i.e. it won't shake hands with us.
+		return opErr.Op != "remote error"
+	}
+	// Only timeouts: syscall.Errno is a net.Error, so file errors would count too.
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// The server hung up on us, before or partway through a response.
+	// A bare io.EOF could be anything; from the client, it's a closed connection.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && errors.Is(urlErr.Err, io.EOF) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
@@ -0,0 +1,113 @@
+package Autolab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+type ScoreState int
+
+const (
+	// No score was given for the problem (null): it hasn't been
+	// graded yet, e.g. while the autograder is still running.
+	ScoreMissing ScoreState = iota
+	ScoreReleased
+	// Autolab returns the string "unreleased" until the
+	// instructor releases scores.
+	ScoreUnreleased
+)
+
+const unreleased = "unreleased"
+
+// A single problem score. Value is only meaningful if the score is released.
+type Score struct {
+	Value float64
+	State ScoreState
+}
+
+func ReleasedScore(v float64) Score {
+	return Score{Value: v, State: ScoreReleased}
+}
+
+func (s Score) Released() bool {
+	return s.State == ScoreReleased
+}
+
+func (s Score) String() string {
+	switch s.State {
+	case ScoreReleased:
+		return strconv.FormatFloat(s.Value, 'f', 2, 64)
+	case ScoreUnreleased:
+		return unreleased
+	default:
+		return "-"
+	}
+}
+
+func (s *Score) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*s = Score{State: ScoreMissing}
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(b, &str); err == nil {
+		if str == unreleased {
+			*s = Score{State: ScoreUnreleased}
+			return nil
+		}
+		// Some numbers come back as strings
+		v, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return fmt.Errorf("unexpected score %q", str)
+		}
+		*s = ReleasedScore(v)
+		return nil
+	}
+
+	var v float64
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("unexpected score %s", b)
+	}
+	*s = ReleasedScore(v)
+	return nil
+}
+
+// Mirrors what Autolab sends us.
+func (s Score) MarshalJSON() ([]byte, error) {
+	switch s.State {
+	case ScoreReleased:
+		return json.Marshal(s.Value)
+	case ScoreUnreleased:
+		return json.Marshal(unreleased)
+	default:
+		return []byte("null"), nil
+	}
+}
+
+// True once every problem has a released score. Missing
+// scores haven't been graded yet, so they hold this up too.
+func (s Scores) Released() bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, score := range s {
+		if !score.Released() {
+			return false
+		}
+	}
+	return true
+}
+
+// Sum of the released scores.
+func (s Scores) Total() float64 {
+	var total float64
+	for _, score := range s {
+		if score.Released() {
+			total += score.Value
+		}
+	}
+	return total
+}
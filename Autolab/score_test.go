@@ -0,0 +1,80 @@
+package Autolab
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestScoreUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    Score
+		wantErr bool
+	}{
+		{`12.5`, ReleasedScore(12.5), false},
+		{`0`, ReleasedScore(0), false},
+		{`"7.25"`, ReleasedScore(7.25), false},
+		{`"unreleased"`, Score{State: ScoreUnreleased}, false},
+		{`null`, Score{State: ScoreMissing}, false},
+		{`"pending"`, Score{}, true},
+		{`true`, Score{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var got Score
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// What we write back out should read the same as what Autolab sent.
+func TestScoreRoundTrip(t *testing.T) {
+	in := `{"a":12.5,"b":"unreleased","c":null}`
+	var scores Scores
+	if err := json.Unmarshal([]byte(in), &scores); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(scores)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Errorf("round trip = %s, want %s", out, in)
+	}
+}
+
+func TestScoresReleased(t *testing.T) {
+	pending := Score{State: ScoreUnreleased}
+	missing := Score{State: ScoreMissing}
+
+	tests := []struct {
+		name      string
+		scores    Scores
+		released  bool
+		wantTotal float64
+	}{
+		{"all released", Scores{"a": ReleasedScore(3), "b": ReleasedScore(4.5)}, true, 7.5},
+		{"some unreleased", Scores{"a": ReleasedScore(3), "b": pending}, false, 3},
+		{"all unreleased", Scores{"a": pending, "b": pending}, false, 0},
+		{"some not graded yet", Scores{"a": ReleasedScore(3), "b": missing}, false, 3},
+		{"none graded yet", Scores{"a": missing, "b": missing}, false, 0},
+		{"no problems", Scores{}, false, 0},
+		{"nil", nil, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scores.Released(); got != tt.released {
+				t.Errorf("Released() = %v, want %v", got, tt.released)
+			}
+			if got := tt.scores.Total(); got != tt.wantTotal {
+				t.Errorf("Total() = %v, want %v", got, tt.wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package Autolab
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"unavailable", &StatusError{Code: http.StatusServiceUnavailable}, true},
+		{"rate limited", &StatusError{Code: http.StatusTooManyRequests}, true},
+		{"not found", &StatusError{Code: http.StatusNotFound}, false},
+		{"connection dropped", &url.Error{Op: "Post", URL: "https://autolab.test", Err: io.EOF}, true},
+		{"connection reset", &url.Error{Op: "Post", URL: "https://autolab.test", Err: &net.OpError{Op: "write", Net: "tcp", Err: syscall.ECONNRESET}}, true},
+		{"timeout", &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, true},
+		{"client timeout", &url.Error{Op: "Post", URL: "https://autolab.test", Err: os.ErrDeadlineExceeded}, true},
+		{"cut short", fmt.Errorf("reading response: %w", io.ErrUnexpectedEOF), true},
+		{"missing file", &os.PathError{Op: "open", Path: "handin.tar", Err: syscall.ENOENT}, false},
+		// The client wraps a failed body read too; it's the cause that counts.
+		{"unreadable file", &url.Error{Op: "Post", URL: "https://autolab.test", Err: &os.PathError{Op: "read", Path: "handin.tar", Err: syscall.EIO}}, false},
+		{"bad certificate", &url.Error{Op: "Post", URL: "https://autolab.test", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, false},
+		{"handshake refused", &url.Error{Op: "Post", URL: "https://autolab.test", Err: &net.OpError{Op: "remote error", Err: errors.New("tls: handshake failure")}}, false},
+		{"bare EOF", io.EOF, false},
+		{"bad json", &json.SyntaxError{}, false},
+		{"refresh refused", &url.Error{Op: "Get", URL: "https://autolab.test", Err: &oauth2.RetrieveError{}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// Serves the submissions list, and drops the connection on upload.
+// Whatever is in arrived shows up in the list once an upload is attempted.
+type fakeAutolab struct {
+	existing []SubmissionsResponse
+	arrived  []SubmissionsResponse
+	lists    atomic.Int32
+	uploads  atomic.Int32
+}
+
+func (f *fakeAutolab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		f.lists.Add(1)
+		subs := f.existing
+		if f.uploads.Load() > 0 {
+			subs = append(append([]SubmissionsResponse{}, subs...), f.arrived...)
+		}
+		json.NewEncoder(w).Encode(subs)
+		return
+	}
+	f.uploads.Add(1)
+	conn, _, _ := w.(http.Hijacker).Hijack()
+	conn.Close()
+}
+
+func TestSubmitFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "handin.tar")
+	os.WriteFile(file, []byte("handin"), 0644)
+	now := time.Now().UTC().Format(time.RFC3339)
+	lastWeek := time.Now().Add(-7 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	previous := SubmissionsResponse{Version: 1, Filename: "me@buffalo.edu_1_handin.tar", Submitted: lastWeek}
+
+	tests := []struct {
+		name        string
+		file        string
+		arrived     []SubmissionsResponse
+		wantVersion int
+		wantErr     error
+		// Autolab may or may not see an upload that fails partway.
+		maxUploads int32
+		// Once before uploading, then once after each failed upload.
+		wantLists int32
+	}{
+		{
+			name:        "ours went through",
+			file:        file,
+			arrived:     []SubmissionsResponse{{Version: 2, Filename: "me@buffalo.edu_2_handin.tar", Submitted: now}},
+			wantVersion: 2,
+			maxUploads:  1,
+			wantLists:   2,
+		},
+		{
+			name:       "a teammate's went through",
+			file:       file,
+			arrived:    []SubmissionsResponse{{Version: 2, Filename: "them@buffalo.edu_2_other.zip", Submitted: now}},
+			wantErr:    ErrSubmitUnconfirmed,
+			maxUploads: 1,
+			wantLists:  2,
+		},
+		{
+			name:       "same name, but from before we started",
+			file:       file,
+			arrived:    []SubmissionsResponse{{Version: 2, Filename: "me@buffalo.edu_2_handin.tar", Submitted: lastWeek}},
+			wantErr:    ErrSubmitUnconfirmed,
+			maxUploads: 1,
+			wantLists:  2,
+		},
+		{
+			name:      "missing file isn't retried",
+			file:      filepath.Join(t.TempDir(), "missing.tar"),
+			wantErr:   os.ErrNotExist,
+			wantLists: 1,
+		},
+		{
+			// Opens fine, but fails once the upload starts reading it.
+			name:       "unreadable file isn't retried",
+			file:       t.TempDir(),
+			wantErr:    syscall.EISDIR,
+			maxUploads: 1,
+			wantLists:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeAutolab{existing: []SubmissionsResponse{previous}, arrived: tt.arrived}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+			a := Autolab{c: server.Client(), host: server.URL}
+
+			resp, err := a.SubmitFile("course", "assessment", tt.file, SubmitOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if resp.Version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", resp.Version, tt.wantVersion)
+			}
+			if got := fake.uploads.Load(); got > tt.maxUploads {
+				t.Errorf("uploads = %d, want at most %d", got, tt.maxUploads)
+			}
+			if got := fake.lists.Load(); got != tt.wantLists {
+				t.Errorf("listed submissions %d times, want %d", got, tt.wantLists)
+			}
+		})
+	}
+}
@@ -5,11 +5,28 @@ import (
 	"time"
 )
 
-// Parse times returned from Autolab API
-func ParseTime(t string) time.Time {
-	layout := "2006-01-02T15:04:05.000-07:00"
-	parsed, _ := time.Parse(layout, t)
-	return parsed
+// Layouts we've seen (or might see) from the Autolab API.
+// RFC 3339 also covers fractional seconds and "Z".
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000-0700",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+}
+
+// Parse times returned from Autolab API.
+// Times keep the offset Autolab sent; convert with In for display.
+func ParseTime(t string) (time.Time, error) {
+	if t == "" {
+		return time.Time{}, fmt.Errorf("empty time")
+	}
+	for _, layout := range timeLayouts {
+		if parsed, err := time.Parse(layout, t); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", t)
 }
 
 // TODO: Organize by scopes
@@ -69,14 +86,22 @@ type AssessmentDetailsResponse struct {
 	HasAutograder             bool   `json:"has_autograder"`
 }
 
+// GET /courses/:course_name/assessments/:assessment_name/problems
+// Requires instructor scopes.
+type ProblemsResponse struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	MaxScore    float64 `json:"max_score"`
+	Optional    bool    `json:"optional"`
+}
+
 type SubmitResponse struct {
 	Version  int    `json:"version"`
 	Filename string `json:"filename"`
 }
 
-// Value is either float or 'unreleased' if score has not been
-// released yet
-type Scores map[string]float64
+// Score per problem; see Score for unreleased ones.
+type Scores map[string]Score
 type SubmissionsResponse struct {
 	Version   int    `json:"version"`
 	Filename  string `json:"filename"`
@@ -108,6 +133,10 @@ func UrlAssessments(host, course string) string {
 	return host + "/api/v1" + "/courses" + "/" + course + "/assessments"
 }
 
+func UrlProblems(host, course, assessment string) string {
+	return fmt.Sprintf("%s/api/v1/courses/%s/assessments/%s/problems", host, course, assessment)
+}
+
 func UrlSubmissions(host, course, assessment string) string {
 	return fmt.Sprintf("%s/api/v1/courses/%s/assessments/%s/submissions", host, course, assessment)
 }
@@ -0,0 +1,47 @@
+package Autolab
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	est := time.FixedZone("", -5*60*60)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		// What Autolab sends.
+		{"2024-03-01T23:59:00.000-05:00", time.Date(2024, time.March, 1, 23, 59, 0, 0, est), false},
+		{"2024-03-01T23:59:00.000-0500", time.Date(2024, time.March, 1, 23, 59, 0, 0, est), false},
+		{"2024-03-01T23:59:00-05:00", time.Date(2024, time.March, 1, 23, 59, 0, 0, est), false},
+		{"2024-03-02T04:59:00Z", time.Date(2024, time.March, 2, 4, 59, 0, 0, time.UTC), false},
+		{"2024-03-01T23:59:00.123456-05:00", time.Date(2024, time.March, 1, 23, 59, 0, 123456000, est), false},
+		{"2024-03-01 23:59:00 -0500", time.Date(2024, time.March, 1, 23, 59, 0, 0, est), false},
+		{"2024-03-02 04:59:00 UTC", time.Date(2024, time.March, 2, 4, 59, 0, 0, time.UTC), false},
+		{"", time.Time{}, true},
+		{"tomorrow", time.Time{}, true},
+		{"2024-03-01", time.Time{}, true},
+		{"2024-13-01T23:59:00.000-05:00", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseTime(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			// The offset is kept, not converted to local time.
+			if !tt.wantErr {
+				_, gotOffset := got.Zone()
+				_, wantOffset := tt.want.Zone()
+				if gotOffset != wantOffset {
+					t.Errorf("offset = %d, want %d", gotOffset, wantOffset)
+				}
+			}
+		})
+	}
+}
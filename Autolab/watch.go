@@ -0,0 +1,144 @@
+package Autolab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Autolab doesn't tell us what the grader is doing,
+// so these are inferred from the submissions list.
+type WatchState int
+
+const (
+	// The submission hasn't shown up yet.
+	WatchQueued WatchState = iota
+	// The submission exists, but not every score is in (or released) yet.
+	WatchGrading
+	// Every score is released.
+	WatchGraded
+)
+
+func (s WatchState) String() string {
+	switch s {
+	case WatchQueued:
+		return "queued"
+	case WatchGrading:
+		return "grading"
+	case WatchGraded:
+		return "graded"
+	}
+	return "unknown"
+}
+
+// Sent whenever the state of a watched submission changes.
+type WatchUpdate struct {
+	State   WatchState
+	Elapsed time.Duration
+	// Empty while queued.
+	Submission SubmissionsResponse
+}
+
+type WatchOptions struct {
+	// Give up after this long. Default 10 minutes.
+	Timeout time.Duration
+	// Polling starts at MinInterval and doubles (with jitter) up to MaxInterval.
+	// Defaults 2s and 30s.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// Called on every state transition. Optional.
+	OnUpdate func(WatchUpdate)
+}
+
+var ErrWatchTimeout = errors.New("timed out waiting for grading")
+
+func (o WatchOptions) withDefaults() WatchOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Minute
+	}
+	if o.MinInterval <= 0 {
+		o.MinInterval = 2 * time.Second
+	}
+	if o.MaxInterval < o.MinInterval {
+		o.MaxInterval = max(30*time.Second, o.MinInterval)
+	}
+	return o
+}
+
+// Wait for a specific version (i.e. the one returned by SubmitFile) to be graded.
+// Errors while polling are retried until the timeout;
+// if we time out, the last error (if any) is included.
+func (a Autolab) WatchSubmission(ctx context.Context, course, assessment string, version int, opts WatchOptions) (SubmissionsResponse, error) {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	state := WatchState(-1)
+	update := func(s WatchState, sub SubmissionsResponse) {
+		if s == state {
+			return
+		}
+		state = s
+		if opts.OnUpdate != nil {
+			opts.OnUpdate(WatchUpdate{State: s, Elapsed: time.Since(start), Submission: sub})
+		}
+	}
+	update(WatchQueued, SubmissionsResponse{})
+
+	interval := opts.MinInterval
+	var lastErr error
+	for poll := 1; ; poll++ {
+		pollCtx, span := tracer.Start(ctx, "poll", trace.WithAttributes(attribute.Int("decanter.poll", poll)))
+		submissions, err := a.getSubmissions(pollCtx, course, assessment)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		lastErr = err
+		if err == nil {
+			if sub, ok := findVersion(submissions, version); ok {
+				if sub.Scores.Released() {
+					update(WatchGraded, sub)
+					return sub, nil
+				}
+				update(WatchGrading, sub)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return SubmissionsResponse{}, ctx.Err()
+			}
+			if lastErr != nil {
+				return SubmissionsResponse{}, fmt.Errorf("%w (last error: %v)", ErrWatchTimeout, lastErr)
+			}
+			return SubmissionsResponse{}, ErrWatchTimeout
+		case <-time.After(Jitter(interval)):
+		}
+		interval = min(interval*2, opts.MaxInterval)
+	}
+}
+
+func findVersion(submissions []SubmissionsResponse, version int) (SubmissionsResponse, bool) {
+	for _, sub := range submissions {
+		if sub.Version == version {
+			return sub, true
+		}
+	}
+	return SubmissionsResponse{}, false
+}
+
+// Spread d by +/- 20% so many clients don't poll (or retry) in lockstep.
+func Jitter(d time.Duration) time.Duration {
+	spread := float64(d) * 0.2
+	return d + time.Duration(spread*(2*rand.Float64()-1))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RFC 5545 calendar of assessment deadlines.
+// UIDs are derived from course + assessment, so re-importing (or
+// subscribing) updates existing events instead of duplicating them.
+
+const icsTimeLayout = "20060102T150405Z"
+
+func buildCalendar(rows []courseAssessment, now time.Time) string {
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(foldLine(s))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//decanter//Autolab deadlines//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:Autolab")
+
+	stamp := now.UTC().Format(icsTimeLayout)
+	// Relative times would be stale by the time anyone reads them.
+	style := displayStyle
+	if style == timeRelative {
+		style = timeAbsolute
+	}
+	for _, row := range rows {
+		if row.Err != nil {
+			continue
+		}
+		ass := row.Assessment
+		// Checked by fetchAssessments, which made any bad ones error rows.
+		due, _ := autolabTime(ass.Due)
+		if due.IsZero() {
+			continue
+		}
+		start, _ := autolabTime(ass.Assigned)
+		end, _ := autolabTime(ass.Closed)
+
+		name := ass.DisplayName
+		if name == "" {
+			name = ass.Name
+		}
+
+		desc := fmt.Sprintf("Course: %s\nAssessment: %s", row.Course, ass.Name)
+		if !start.IsZero() {
+			desc += "\nReleased: " + formatTimeAs(style, start)
+		}
+		if end.After(due) {
+			desc += "\nLate submissions close: " + formatTimeAs(style, end)
+		}
+
+		line("BEGIN:VEVENT")
+		line("UID:" + calendarUID(row.Course, ass.Name))
+		line("DTSTAMP:" + stamp)
+		line("DTSTART:" + due.UTC().Format(icsTimeLayout))
+		line("DTEND:" + due.UTC().Format(icsTimeLayout))
+		line("SUMMARY:" + escapeText(fmt.Sprintf("%s due (%s)", name, row.Course)))
+		line("DESCRIPTION:" + escapeText(desc))
+		if ass.Category != "" {
+			line("CATEGORIES:" + escapeText(ass.Category))
+		}
+		line("TRANSP:TRANSPARENT")
+
+		if !start.IsZero() && start.Before(due) {
+			alarmAt(line, start, fmt.Sprintf("%s released", name))
+		}
+		alarmBefore(line, "-P1D", fmt.Sprintf("%s is due tomorrow", name))
+		alarmBefore(line, "-PT1H", fmt.Sprintf("%s is due in an hour", name))
+		if end.After(due) {
+			alarmAt(line, end.Add(-time.Hour), fmt.Sprintf("Late submissions for %s close in an hour", name))
+		}
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+func alarmBefore(line func(string), trigger, desc string) {
+	line("BEGIN:VALARM")
+	line("ACTION:DISPLAY")
+	line("TRIGGER:" + trigger)
+	line("DESCRIPTION:" + escapeText(desc))
+	line("END:VALARM")
+}
+
+func alarmAt(line func(string), at time.Time, desc string) {
+	line("BEGIN:VALARM")
+	line("ACTION:DISPLAY")
+	line("TRIGGER;VALUE=DATE-TIME:" + at.UTC().Format(icsTimeLayout))
+	line("DESCRIPTION:" + escapeText(desc))
+	line("END:VALARM")
+}
+
+func calendarUID(course, assessment string) string {
+	sum := sha1.Sum([]byte(course + "/" + assessment))
+	return fmt.Sprintf("%x@decanter", sum)
+}
+
+// RFC 5545 3.3.11
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// Lines longer than 75 octets are folded with CRLF + space (RFC 5545 3.1),
+// taking care not to split UTF-8 sequences.
+func foldLine(s string) string {
+	const limit = 75
+	if len(s) <= limit {
+		return s
+	}
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		n := len(string(r))
+		// Continuation lines start with a space, which counts towards the limit.
+		if width+n > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += n
+	}
+	return b.String()
+}
+
+// Assessments for the calendar, from the requested semester(s).
+func (d Decanter) calendarRows(semester string, all bool) ([]courseAssessment, error) {
+	courses, err := d.GetUserCourses()
+	if err != nil {
+		return nil, err
+	}
+	if !all {
+		_, courses = d.coursesIn(semester, courses)
+	}
+	return d.fetchAssessments(courses), nil
+}
+
+// Serve the calendar for calendar apps to subscribe to.
+// It's rebuilt at most every cacheFor, so apps polling often don't hit Autolab each time.
+func (d Decanter) serveCalendar(addr, semester string, all bool) error {
+	const cacheFor = 10 * time.Minute
+	var (
+		mu      sync.Mutex
+		cached  string
+		builtAt time.Time
+	)
+
+	http.HandleFunc("/decanter.ics", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if cached == "" || time.Since(builtAt) > cacheFor {
+			rows, err := d.calendarRows(semester, all)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			cached, builtAt = buildCalendar(rows, time.Now()), time.Now()
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		fmt.Fprint(w, cached)
+	})
+
+	return http.ListenAndServe(addr, nil)
+}
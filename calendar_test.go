@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+func TestBuildCalendar(t *testing.T) {
+	defer func(loc *time.Location, style timeStyle) { displayLocation, displayStyle = loc, style }(displayLocation, displayStyle)
+	displayLocation = time.FixedZone("EST", -5*60*60)
+	// Relative times must not leak into the file.
+	displayStyle = timeRelative
+
+	rows := []courseAssessment{
+		{Course: "cse220-s24", Assessment: Autolab.AssessmentsResponse{
+			Name:        "pa3",
+			DisplayName: "PA3: Linked Lists, Stacks; and C:\\Paths",
+			Assigned:    "2024-02-20T09:00:00.000-05:00",
+			Due:         "2024-03-01T23:59:00.000-05:00",
+			Closed:      "2024-03-03T23:59:00.000-05:00",
+			Category:    "Programming Assignments",
+		}},
+		{Course: "cse220-s24", Assessment: Autolab.AssessmentsResponse{
+			Name:        "essay",
+			DisplayName: "Écriture — réflexions sur les systèmes d'exploitation modernes et leurs 設計",
+			Due:         "2024-03-10T12:00:00.000+09:00",
+		}},
+		// Skipped: no due date, and a row that failed to load.
+		{Course: "cse220-s24", Assessment: Autolab.AssessmentsResponse{Name: "survey"}},
+		{Course: "cse250-s24", Err: errors.New("unexpected status code: 500")},
+	}
+	now := time.Date(2024, time.February, 25, 12, 0, 0, 0, time.UTC)
+	got := buildCalendar(rows, now)
+
+	golden := filepath.Join("testdata", "calendar.ics")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("calendar differs from %s (run with -update to accept):\n%s", golden, got)
+	}
+
+	for _, l := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("line is %d octets: %q", len(l), l)
+		}
+		if !utf8.ValidString(l) {
+			t.Errorf("line splits a character: %q", l)
+		}
+	}
+}
+
+func TestFoldLine(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"short", "SUMMARY:pa3", "SUMMARY:pa3"},
+		{"exactly 75", strings.Repeat("a", 75), strings.Repeat("a", 75)},
+		{"76", strings.Repeat("a", 76), strings.Repeat("a", 75) + "\r\n a"},
+		{"continuations hold 74", strings.Repeat("a", 150),
+			strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 74) + "\r\n a"},
+		// é is 2 octets, so the 38th would end at octet 76.
+		{"two-byte characters", strings.Repeat("é", 40),
+			strings.Repeat("é", 37) + "\r\n " + strings.Repeat("é", 3)},
+		// 設 is 3 octets: 25 fill the line exactly.
+		{"three-byte characters", strings.Repeat("設", 26),
+			strings.Repeat("設", 25) + "\r\n 設"},
+		{"mixed", strings.Repeat("a", 74) + "設b",
+			strings.Repeat("a", 74) + "\r\n 設b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := foldLine(tt.in); got != tt.want {
+				t.Errorf("foldLine = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"PA3 due (cse220-s24)", "PA3 due (cse220-s24)"},
+		{"Lists, Stacks; Queues", `Lists\, Stacks\; Queues`},
+		{`C:\Paths`, `C:\\Paths`},
+		{"Course: cse220\nAssessment: pa3", `Course: cse220\nAssessment: pa3`},
+		// Backslashes first, so the ones we add aren't doubled.
+		{`a\,b`, `a\\\,b`},
+	}
+	for _, tt := range tests {
+		if got := escapeText(tt.in); got != tt.want {
+			t.Errorf("escapeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
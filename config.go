@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path"
+
+	"github.com/BurntSushi/toml"
+)
+
+// User configuration is read from ~/.decanter/config.toml,
+// and then overridden by a .decanter.toml in the working directory
+// (so that per-project settings can live next to the project).
+const (
+	globalConfigFile  = "config.toml"
+	projectConfigFile = ".decanter.toml"
+)
+
+type Config struct {
+	// Term calendar used to work out the current semester.
+	// Order matters: terms are listed in the order they occur in a year.
+	Terms []Term `toml:"terms"`
+
+	// Max score per problem, by course and assessment, i.e.
+	//  [max_scores.cse486-s24.PA2]
+	//  "Part A" = 10
+	// Used to show totals when the API won't tell us.
+	MaxScores map[string]map[string]map[string]float64 `toml:"max_scores"`
+
+	// Used by --notify.
+	Notify NotifyConfig `toml:"notify"`
+
+	// IANA name, i.e. "America/New_York". Defaults to local time.
+	Timezone string `toml:"timezone"`
+	// absolute|relative|iso, overridden by --time-style.
+	TimeStyle string `toml:"time_style"`
+
+	// Only used if the user opted in to telemetry.
+	Telemetry TelemetryConfig `toml:"telemetry"`
+
+	Tracing TracingConfig `toml:"tracing"`
+}
+
+// A term starts on Start (MM-DD) and runs until the next term starts.
+// Autolab semesters are named Code + two digit year, i.e. "s25".
+type Term struct {
+	Code  string `toml:"code"`
+	Start string `toml:"start"`
+}
+
+// UB's calendar, roughly.
+var defaultTerms = []Term{
+	{Code: "s", Start: "01-01"},
+	{Code: "u", Start: "05-20"},
+	{Code: "f", Start: "08-15"},
+}
+
+func defaultConfig() Config {
+	return Config{
+		Terms: defaultTerms,
+		Notify: NotifyConfig{
+			Methods: defaultNotifyMethods,
+		},
+	}
+}
+
+func decanterDir() string {
+	home, _ := os.UserHomeDir()
+	return path.Join(home, ".decanter")
+}
+
+// Missing files are fine, we just fall back to defaults.
+func LoadConfig() (Config, error) {
+	conf := defaultConfig()
+	for _, f := range []string{path.Join(decanterDir(), globalConfigFile), projectConfigFile} {
+		if _, err := os.Stat(f); err != nil {
+			continue
+		}
+		if _, err := toml.DecodeFile(f, &conf); err != nil {
+			return defaultConfig(), err
+		}
+	}
+	if len(conf.Terms) == 0 {
+		conf.Terms = defaultTerms
+	}
+	return conf, nil
+}
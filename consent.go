@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// Telemetry is off until the user says otherwise,
+// either during setup or with `decanter telemetry enable`.
+type telemetrySettings struct {
+	Enabled bool `json:"enabled"`
+	// Zero if the user was never asked.
+	DecidedAt time.Time `json:"decided_at"`
+	// Random, per install. Course and assessment names are
+	// hashed with it before they're sent (see scrub.go).
+	Salt string `json:"salt,omitempty"`
+}
+
+func telemetrySettingsFile() string {
+	return path.Join(decanterDir(), "telemetry.json")
+}
+
+// A missing or unreadable file means telemetry is off.
+func loadTelemetrySettings() telemetrySettings {
+	var settings telemetrySettings
+	b, err := os.ReadFile(telemetrySettingsFile())
+	if err != nil {
+		return telemetrySettings{}
+	}
+	if err := json.Unmarshal(b, &settings); err != nil {
+		return telemetrySettings{}
+	}
+	return settings
+}
+
+func setTelemetryEnabled(enabled bool) error {
+	settings := loadTelemetrySettings()
+	settings.Enabled = enabled
+	settings.DecidedAt = time.Now()
+	return saveTelemetrySettings(settings)
+}
+
+func saveTelemetrySettings(settings telemetrySettings) error {
+	os.MkdirAll(decanterDir(), 0755)
+	b, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(telemetrySettingsFile(), b, 0600)
+}
+
+// The install's salt, made on first use.
+func telemetrySalt() (string, error) {
+	settings := loadTelemetrySettings()
+	if settings.Salt != "" {
+		return settings.Salt, nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	settings.Salt = hex.EncodeToString(b)
+	return settings.Salt, saveTelemetrySettings(settings)
+}
+
+const (
+	telemetryKindRequest = "request"
+	telemetryKindError   = "error"
+)
+
+// One line of the local telemetry log.
+type telemetryRecord struct {
+	Time time.Time `json:"time"`
+	// request|error
+	Kind string `json:"kind"`
+	// Exactly what was sent, a requestEvent or errorEvent.
+	Event json.RawMessage `json:"event"`
+}
+
+// Every event sent is also appended to ~/.decanter/telemetry.jsonl,
+// so users can see for themselves (`decanter telemetry show`).
+type telemetryLog struct {
+	file string
+	mu   *sync.Mutex
+}
+
+func newTelemetryLog() telemetryLog {
+	return telemetryLog{
+		file: path.Join(decanterDir(), "telemetry.jsonl"),
+		mu:   &sync.Mutex{},
+	}
+}
+
+func newTelemetryRecord(kind string, event any) (telemetryRecord, error) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return telemetryRecord{}, err
+	}
+	return telemetryRecord{Time: time.Now(), Kind: kind, Event: b}, nil
+}
+
+func (l telemetryLog) Append(kind string, event any) error {
+	record, err := newTelemetryRecord(kind, event)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// The last n records (all of them if n <= 0), oldest first.
+func (l telemetryLog) Tail(n int) ([]telemetryRecord, error) {
+	f, err := os.Open(l.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []telemetryRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r telemetryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// Skip anything half written.
+			continue
+		}
+		records = append(records, r)
+		if n > 0 && len(records) > n {
+			records = records[1:]
+		}
+	}
+	return records, scanner.Err()
+}
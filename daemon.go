@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+const (
+	// How often the daemon checks the queue for new submissions.
+	daemonInterval = 5 * time.Second
+	// How long the daemon waits on a single submission.
+	daemonWatchTimeout = 2 * time.Hour
+)
+
+// The daemon touches this file while it's running, with its pid inside,
+// which is how we tell whether one needs to be started. Only the daemon
+// named in it may run; it changes hands under the queue lock.
+func daemonHeartbeatFile() string {
+	return path.Join(decanterDir(), "daemon.pid")
+}
+
+func daemonRunning() bool {
+	_, ok := daemonHolder()
+	return ok
+}
+
+// The pid of the running daemon, if any.
+func daemonHolder() (int, bool) {
+	info, err := os.Stat(daemonHeartbeatFile())
+	if err != nil || time.Since(info.ModTime()) >= 3*daemonInterval {
+		return 0, false
+	}
+	b, err := os.ReadFile(daemonHeartbeatFile())
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(string(b))
+	return pid, err == nil
+}
+
+func beat(pid int) error {
+	return os.WriteFile(daemonHeartbeatFile(), []byte(strconv.Itoa(pid)), 0644)
+}
+
+// Beat for pid, unless another daemon is running.
+// Reports whether pid holds the heartbeat.
+func claimHeartbeat(queue submissionQueue, pid int) (bool, error) {
+	unlock, err := acquireLock(queue.lock)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if holder, ok := daemonHolder(); ok && holder != pid {
+		return false, nil
+	}
+	return true, beat(pid)
+}
+
+// Stop beating, if pid is still the one beating.
+func releaseHeartbeat(pid int) {
+	if holder, ok := daemonHolder(); ok && holder == pid {
+		os.Remove(daemonHeartbeatFile())
+	}
+}
+
+// Start a daemon in the background, unless one is already running.
+func startDaemon() error {
+	// Checking and starting under the queue lock means two of us
+	// can't both see no daemon and start one each.
+	unlock, err := acquireLock(newSubmissionQueue().lock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if daemonRunning() {
+		return nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(path.Join(decanterDir(), "daemon.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, "daemon")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Beat on the daemon's behalf until it gets going.
+	if err := beat(cmd.Process.Pid); err != nil {
+		cmd.Process.Kill()
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// Watch every pending submission in the queue, saving results as they come in.
+// Exits once nothing is left to watch.
+func (d Decanter) runDaemon(ctx context.Context) error {
+	queue := newSubmissionQueue()
+	type finished struct {
+		key    string
+		result submitOutput
+		err    error
+	}
+	results := make(chan finished)
+	watching := map[string]bool{}
+
+	pid := os.Getpid()
+	ticker := time.NewTicker(daemonInterval)
+	defer ticker.Stop()
+	defer releaseHeartbeat(pid)
+
+	for {
+		held, err := claimHeartbeat(queue, pid)
+		if err != nil {
+			return err
+		}
+		if !held {
+			// Anything we were watching is still pending, so it gets picked up there.
+			fmt.Printf("%s another daemon is running, exiting\n", time.Now().Format(time.RFC3339))
+			return nil
+		}
+
+		entries, err := queue.Load()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.done() || watching[e.key()] {
+				continue
+			}
+			watching[e.key()] = true
+			fmt.Printf("%s watching %s\n", time.Now().Format(time.RFC3339), e.key())
+
+			go func(e queuedSubmission) {
+				opts := Autolab.WatchOptions{
+					Timeout: daemonWatchTimeout,
+					OnUpdate: func(u Autolab.WatchUpdate) {
+						queue.Set(e.key(), func(q *queuedSubmission) { q.State = u.State.String() })
+					},
+				}
+				result := submitOutput{Course: e.Course, Assessment: e.Assessment, File: e.File}
+				result.Version = e.Version
+				graded, err := d.WatchSubmission(ctx, e.Course, e.Assessment, e.Version, opts)
+				if err == nil {
+					result = d.completeResult(result, graded)
+				}
+				results <- finished{e.key(), result, err}
+			}(e)
+		}
+
+		if len(watching) == 0 {
+			// Stop beating under the queue lock, so anything added
+			// meanwhile is either picked up here or starts a new daemon.
+			idle, err := queue.whenIdle(func() { releaseHeartbeat(pid) })
+			if err != nil {
+				return err
+			}
+			if idle {
+				return nil
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case f := <-results:
+			delete(watching, f.key)
+			fmt.Printf("%s finished %s (error: %v)\n", time.Now().Format(time.RFC3339), f.key, f.err)
+
+			var notify bool
+			err := queue.Set(f.key, func(q *queuedSubmission) {
+				notify = q.Notify
+				if f.err != nil {
+					q.State = queueStateFailed
+					q.Error = f.err.Error()
+					return
+				}
+				q.State = Autolab.WatchGraded.String()
+				q.Result = &f.result
+			})
+			if err != nil {
+				fmt.Println("Could not save result:", err)
+			}
+			if notify && f.err == nil {
+				d.notify(f.result)
+			}
+		case <-ticker.C:
+		}
+	}
+}
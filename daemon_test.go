@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestClaimHeartbeat(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	queue := newSubmissionQueue()
+	claim := func(pid int, want bool) {
+		t.Helper()
+		held, err := claimHeartbeat(queue, pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if held != want {
+			t.Errorf("claimHeartbeat(%d) = %v, want %v", pid, held, want)
+		}
+	}
+
+	claim(100, true)
+	claim(100, true)
+	claim(200, false)
+	if holder, _ := daemonHolder(); holder != 100 {
+		t.Errorf("holder = %d, want 100", holder)
+	}
+
+	// Only the holder can let go.
+	releaseHeartbeat(200)
+	if !daemonRunning() {
+		t.Fatal("heartbeat released by a daemon that didn't hold it")
+	}
+	releaseHeartbeat(100)
+	if daemonRunning() {
+		t.Fatal("heartbeat still held after release")
+	}
+	claim(200, true)
+
+	// A daemon that stopped beating has died.
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(daemonHeartbeatFile(), old, old); err != nil {
+		t.Fatal(err)
+	}
+	claim(300, true)
+}
+
+func TestRunDaemonExitsIfAnotherIsRunning(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	queue := newSubmissionQueue()
+	if err := queue.Add(queuedSubmission{Course: "cse220-s24", Assessment: "pa3", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := claimHeartbeat(queue, os.Getpid()+1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := (Decanter{}).runDaemon(ctx); err != nil {
+		t.Fatalf("runDaemon = %v, want it to step aside", err)
+	}
+	if holder, _ := daemonHolder(); holder != os.Getpid()+1 {
+		t.Errorf("holder = %d, want the other daemon to keep it", holder)
+	}
+}
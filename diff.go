@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+// Change in a single problem's score between two versions.
+// From/To are nil if the problem is missing from that version.
+type problemDiff struct {
+	Problem string   `json:"problem"`
+	From    *float64 `json:"from"`
+	To      *float64 `json:"to"`
+	Delta   float64  `json:"delta"`
+}
+
+type scoreDiff struct {
+	From     int           `json:"from_version"`
+	To       int           `json:"to_version"`
+	Problems []problemDiff `json:"problems"`
+	Net      float64       `json:"net"`
+}
+
+func diffSubmissions(from, to Autolab.SubmissionsResponse) scoreDiff {
+	d := scoreDiff{From: from.Version, To: to.Version}
+
+	seen := map[string]bool{}
+	var problems []string
+	for _, scores := range []Autolab.Scores{from.Scores, to.Scores} {
+		for p := range scores {
+			if !seen[p] {
+				seen[p] = true
+				problems = append(problems, p)
+			}
+		}
+	}
+	sort.Strings(problems)
+
+	for _, p := range problems {
+		pd := problemDiff{Problem: p}
+		// Unreleased scores are treated as missing
+		if s := from.Scores[p]; s.Released() {
+			pd.From = &s.Value
+		}
+		if s := to.Scores[p]; s.Released() {
+			pd.To = &s.Value
+		}
+		if pd.From != nil {
+			pd.Delta -= *pd.From
+		}
+		if pd.To != nil {
+			pd.Delta += *pd.To
+		}
+		d.Net += pd.Delta
+		d.Problems = append(d.Problems, pd)
+	}
+	return d
+}
+
+// Find the two versions to compare.
+// No versions: previous vs. latest. One version: that vs. latest.
+func pickDiffVersions(submissions []Autolab.SubmissionsResponse, args []string) (from, to Autolab.SubmissionsResponse, err error) {
+	history := newSubmissionHistory(submissions)
+	if err := history.sortBy("version"); err != nil {
+		return from, to, err
+	}
+
+	var versions []int
+	for _, arg := range args {
+		v, err := strconv.Atoi(arg)
+		if err != nil {
+			return from, to, fmt.Errorf("%q is not a version number", arg)
+		}
+		versions = append(versions, v)
+	}
+
+	switch len(versions) {
+	case 0:
+		if len(history) < 2 {
+			return from, to, fmt.Errorf("need at least two submissions to compare")
+		}
+		return history[1].SubmissionsResponse, history[0].SubmissionsResponse, nil
+	case 1:
+		if len(history) < 1 {
+			return from, to, fmt.Errorf("no submissions found")
+		}
+		versions = append(versions, history[0].Version)
+	case 2:
+	default:
+		return from, to, fmt.Errorf("expected at most two versions")
+	}
+
+	f, ok := history.version(versions[0])
+	if !ok {
+		return from, to, fmt.Errorf("no version %d found", versions[0])
+	}
+	t, ok := history.version(versions[1])
+	if !ok {
+		return from, to, fmt.Errorf("no version %d found", versions[1])
+	}
+	return f.SubmissionsResponse, t.SubmissionsResponse, nil
+}
+
+// Find the submission that came right before version.
+func previousSubmission(submissions []Autolab.SubmissionsResponse, version int) (Autolab.SubmissionsResponse, bool) {
+	var prev Autolab.SubmissionsResponse
+	found := false
+	for _, sub := range submissions {
+		if sub.Version < version && (!found || sub.Version > prev.Version) {
+			prev, found = sub, true
+		}
+	}
+	return prev, found
+}
+
+func (d scoreDiff) csvHeader() []string {
+	return []string{"problem", "v" + strconv.Itoa(d.From), "v" + strconv.Itoa(d.To), "delta"}
+}
+
+func (d scoreDiff) csvRows() [][]string {
+	score := func(f *float64) string {
+		if f == nil {
+			return ""
+		}
+		return formatFloat(*f)
+	}
+	var rows [][]string
+	for _, p := range d.Problems {
+		rows = append(rows, []string{p.Problem, score(p.From), score(p.To), formatFloat(p.Delta)})
+	}
+	return append(rows, []string{"net", "", "", formatFloat(d.Net)})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+func ptr(f float64) *float64 { return &f }
+
+func TestDiffSubmissions(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to Autolab.Scores
+		want     []problemDiff
+		wantNet  float64
+	}{
+		{"improved",
+			Autolab.Scores{"a": Autolab.ReleasedScore(3), "b": Autolab.ReleasedScore(5)},
+			Autolab.Scores{"a": Autolab.ReleasedScore(4.5), "b": Autolab.ReleasedScore(5)},
+			[]problemDiff{{"a", ptr(3), ptr(4.5), 1.5}, {"b", ptr(5), ptr(5), 0}},
+			1.5},
+		{"problem added",
+			Autolab.Scores{"a": Autolab.ReleasedScore(3)},
+			Autolab.Scores{"a": Autolab.ReleasedScore(3), "b": Autolab.ReleasedScore(2)},
+			[]problemDiff{{"a", ptr(3), ptr(3), 0}, {"b", nil, ptr(2), 2}},
+			2},
+		{"problem removed",
+			Autolab.Scores{"a": Autolab.ReleasedScore(3), "b": Autolab.ReleasedScore(2)},
+			Autolab.Scores{"a": Autolab.ReleasedScore(3)},
+			[]problemDiff{{"a", ptr(3), ptr(3), 0}, {"b", ptr(2), nil, -2}},
+			-2},
+		{"unreleased is treated as missing",
+			Autolab.Scores{"a": Autolab.ReleasedScore(3), "b": Autolab.ReleasedScore(1)},
+			Autolab.Scores{"a": pending, "b": {}},
+			[]problemDiff{{"a", ptr(3), nil, -3}, {"b", ptr(1), nil, -1}},
+			-4},
+		{"nothing released", Autolab.Scores{"a": pending}, Autolab.Scores{"a": pending},
+			[]problemDiff{{"a", nil, nil, 0}}, 0},
+		{"no problems", nil, nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := diffSubmissions(submission(1, "", tt.from), submission(2, "", tt.to))
+			if d.From != 1 || d.To != 2 {
+				t.Errorf("versions = %d -> %d, want 1 -> 2", d.From, d.To)
+			}
+			if !reflect.DeepEqual(d.Problems, tt.want) {
+				t.Errorf("problems = %s, want %s", describeDiffs(d.Problems), describeDiffs(tt.want))
+			}
+			if d.Net != tt.wantNet {
+				t.Errorf("net = %v, want %v", d.Net, tt.wantNet)
+			}
+		})
+	}
+}
+
+// Pointers print as addresses, so compare failures as the CSV would show them.
+func describeDiffs(diffs []problemDiff) [][]string {
+	return scoreDiff{Problems: diffs}.csvRows()
+}
+
+func TestPickDiffVersions(t *testing.T) {
+	subs := []Autolab.SubmissionsResponse{submission(2, "", nil), submission(4, "", nil), submission(1, "", nil)}
+	tests := []struct {
+		name             string
+		subs             []Autolab.SubmissionsResponse
+		args             []string
+		wantFrom, wantTo int
+		wantErr          bool
+	}{
+		{"previous vs latest", subs, nil, 2, 4, false},
+		{"one version vs latest", subs, []string{"1"}, 1, 4, false},
+		{"two versions", subs, []string{"4", "1"}, 4, 1, false},
+		{"only one submission", subs[:1], nil, 0, 0, true},
+		{"no submissions", nil, []string{"1"}, 0, 0, true},
+		{"no such version", subs, []string{"3"}, 0, 0, true},
+		{"not a number", subs, []string{"latest"}, 0, 0, true},
+		{"too many versions", subs, []string{"1", "2", "4"}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := pickDiffVersions(tt.subs, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (from.Version != tt.wantFrom || to.Version != tt.wantTo) {
+				t.Errorf("picked %d -> %d, want %d -> %d", from.Version, to.Version, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestPreviousSubmission(t *testing.T) {
+	subs := []Autolab.SubmissionsResponse{submission(5, "", nil), submission(1, "", nil), submission(3, "", nil)}
+	tests := []struct {
+		version int
+		want    int
+		found   bool
+	}{
+		{5, 3, true},
+		// Versions in between are skipped over.
+		{4, 3, true},
+		{3, 1, true},
+		{1, 0, false},
+	}
+	for _, tt := range tests {
+		prev, found := previousSubmission(subs, tt.version)
+		if found != tt.found || prev.Version != tt.want {
+			t.Errorf("previousSubmission(%d) = %d, %v, want %d, %v", tt.version, prev.Version, found, tt.want, tt.found)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/huh/spinner"
@@ -28,14 +29,14 @@ func displayUserInfo(user Autolab.UserResponse) {
 	fmt.Println(s2)
 }
 
-func displayCourseList(courses []Autolab.CoursesResponse) {
+func displayCourseList(semester string, courses []Autolab.CoursesResponse) {
 	var headerStyle = lipgloss.NewStyle().
 		Align(lipgloss.Left).
 		Bold(true).
 		Foreground(colorPrimary).
 		PaddingTop(1).
 		PaddingLeft(0)
-	fmt.Println(headerStyle.Render("Your Current Courses (s24):"))
+	fmt.Println(headerStyle.Render(fmt.Sprintf("Your Courses (%s):", semester)))
 
 	var courseStyle = lipgloss.NewStyle().
 		Align(lipgloss.Left).
@@ -53,7 +54,7 @@ func displayCourseList(courses []Autolab.CoursesResponse) {
 	fmt.Println(helpStyle.Render(helpStr))
 }
 
-func displayAssessmentList(d Decanter, courses []Autolab.CoursesResponse) {
+func displayAssessmentList(rows []courseAssessment) {
 	var headerStyle = lipgloss.NewStyle().
 		Align(lipgloss.Left).
 		Bold(true).
@@ -82,44 +83,22 @@ func displayAssessmentList(d Decanter, courses []Autolab.CoursesResponse) {
 			}
 		})
 
-	var assessmentsFetched int
-	for _, course := range courses {
-		assessments, _ := d.GetUserAssessments(course.Name)
-		for _, ass := range assessments {
-			assessmentsFetched++
-
-			// TODO: Align columns
-			assTime := func(time_raw string) string {
-				tt := Autolab.ParseTime(time_raw)
-				return fmt.Sprintf("%s %d-%d", tt.Weekday().String()[:3], tt.Month(), tt.Day())
-			}
-
-			t.Row(course.Name, ass.Name, assTime(ass.Assigned), assTime(ass.Due), assTime(ass.Closed))
+	// TODO: Align columns
+	for _, row := range rows {
+		if row.Err != nil {
+			t.Row(row.Course, errorMsg(row.Err.Error()), "", "", "")
+			continue
 		}
+		ass := row.Assessment
+		t.Row(row.Course, ass.Name, formatRawTime(ass.Assigned), formatRawTime(ass.Due), formatRawTime(ass.Closed))
 	}
 	fmt.Println(t.Render())
 }
 
-func displayTime(time_raw string) string {
-	t := Autolab.ParseTime(time_raw)
-	tSuffix := "AM"
-	if t.Hour() >= 12 {
-		tSuffix = "PM"
-	}
-
-	twelveHour := t.Hour()
-	if twelveHour > 12 {
-		twelveHour -= 12
-	}
-
-	return fmt.Sprintf("%s %d-%d (%d:%d%s)", t.Weekday(), t.Month(), t.Day(), twelveHour, t.Minute(), tSuffix)
-}
-
-func displaySubmission(submission Autolab.SubmissionsResponse) {
-	title := emph("Latest Submission")
-	fmt.Println(title)
+func displaySubmission(title string, submission submissionOutput) {
+	fmt.Println(emph(title))
 	fmt.Println(" Version: ", submission.Version)
-	fmt.Println(" Submitted: ", displayTime(submission.Submitted))
+	fmt.Println(" Submitted: ", formatRawTime(submission.Submitted))
 	fmt.Println(" Filename: ", submission.Filename)
 
 	var OddRowStyle = lipgloss.NewStyle().
@@ -128,6 +107,8 @@ func displaySubmission(submission Autolab.SubmissionsResponse) {
 	var EvenRowStyle = lipgloss.NewStyle().
 		Inherit(OddRowStyle)
 
+	problems := submission.problems()
+
 	t := table.New().
 		Headers("Problem", "Score").
 		Border(lipgloss.NormalBorder()).
@@ -135,6 +116,8 @@ func displaySubmission(submission Autolab.SubmissionsResponse) {
 			switch {
 			case r == 0:
 				return lipgloss.NewStyle().Bold(true).Foreground(colorPrimary)
+			case r == len(problems)+1:
+				return lipgloss.NewStyle().Bold(true)
 			case r%2 == 0:
 				return EvenRowStyle
 			default:
@@ -143,8 +126,200 @@ func displaySubmission(submission Autolab.SubmissionsResponse) {
 		})
 	scores := submission.Scores
 
-	for k, v := range scores {
-		t.Row(k, fmt.Sprintf("%.2f", v))
+	for _, k := range problems {
+		t.Row(k, scores[k].String())
+	}
+	t.Row("Total", displayTotal(submission.Total, submission.Max))
+	fmt.Println(t.Render())
+}
+
+func displaySubmissionHistory(history submissionHistory) {
+	var headerStyle = lipgloss.NewStyle().
+		Align(lipgloss.Left).
+		Bold(true).
+		Foreground(colorPrimary).
+		PaddingTop(1).
+		PaddingLeft(0)
+	fmt.Println(headerStyle.Render("Your Submissions:"))
+
+	var OddRowStyle = lipgloss.NewStyle().
+		Align(lipgloss.Left)
+
+	var EvenRowStyle = lipgloss.NewStyle().
+		Inherit(OddRowStyle)
+
+	problems := history.problems()
+	headers := append([]string{"", "Version", "Filename", "Submitted", "Total"}, problems...)
+
+	t := table.New().
+		Headers(headers...).
+		Border(lipgloss.NormalBorder()).
+		StyleFunc(func(r, c int) lipgloss.Style {
+			switch {
+			case r == 0:
+				return lipgloss.NewStyle().Bold(true).Foreground(colorPrimary)
+			case r%2 == 0:
+				return EvenRowStyle
+			default:
+				return OddRowStyle
+			}
+		})
+
+	for _, sub := range history {
+		best := ""
+		if sub.Best {
+			best = bestMark
+		}
+		row := []string{best, fmt.Sprint(sub.Version), sub.Filename, formatRawTime(sub.Submitted), displayTotal(sub.Total, sub.Max)}
+		for _, p := range problems {
+			row = append(row, sub.Scores[p].String())
+		}
+		t.Row(row...)
+	}
+	fmt.Println(t.Render())
+	fmt.Println(bestMark + " best score")
+}
+
+func displayScoreDiff(d scoreDiff) {
+	fmt.Println(emph(fmt.Sprintf("Version %d -> Version %d", d.From, d.To)))
+
+	var improved = lipgloss.NewStyle().Foreground(colorSpecial)
+	var regressed = lipgloss.NewStyle().Foreground(colorPrimary).Bold(true)
+
+	deltaStyle := func(delta float64) lipgloss.Style {
+		switch {
+		case delta > 0:
+			return improved
+		case delta < 0:
+			return regressed
+		default:
+			return lipgloss.NewStyle()
+		}
+	}
+
+	score := func(f *float64) string {
+		if f == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f", *f)
+	}
+
+	t := table.New().
+		Headers("Problem", fmt.Sprintf("v%d", d.From), fmt.Sprintf("v%d", d.To), "Change").
+		Border(lipgloss.NormalBorder()).
+		StyleFunc(func(r, c int) lipgloss.Style {
+			switch {
+			case r == 0:
+				return lipgloss.NewStyle().Bold(true).Foreground(colorPrimary)
+			case c == 3 && r-1 < len(d.Problems):
+				return deltaStyle(d.Problems[r-1].Delta)
+			default:
+				return lipgloss.NewStyle()
+			}
+		})
+
+	for _, p := range d.Problems {
+		t.Row(p.Problem, score(p.From), score(p.To), fmt.Sprintf("%+.2f", p.Delta))
+	}
+	fmt.Println(t.Render())
+	fmt.Println(" Net:", deltaStyle(d.Net).Render(fmt.Sprintf("%+.2f", d.Net)))
+}
+
+func displayQueue(entries []queuedSubmission) {
+	var headerStyle = lipgloss.NewStyle().
+		Align(lipgloss.Left).
+		Bold(true).
+		Foreground(colorPrimary).
+		PaddingTop(1).
+		PaddingLeft(0)
+	fmt.Println(headerStyle.Render("Background Submissions:"))
+
+	if len(entries) == 0 {
+		fmt.Println(" Nothing here. Use 'decanter submit --detach' to grade in the background.")
+		return
+	}
+
+	t := table.New().
+		Headers("Course", "Assessment", "Version", "State", "Submitted", "Result").
+		Border(lipgloss.NormalBorder()).
+		StyleFunc(func(r, c int) lipgloss.Style {
+			switch {
+			case r == 0:
+				return lipgloss.NewStyle().Bold(true).Foreground(colorPrimary)
+			case c == 3:
+				return watchStateStyle(entries[r-1].State)
+			default:
+				return lipgloss.NewStyle()
+			}
+		})
+
+	for _, e := range entries {
+		var result string
+		switch {
+		case e.Error != "":
+			result = e.Error
+		case e.Result != nil && e.Result.Graded != nil:
+			result = displayTotal(e.Result.Graded.Total, e.Result.Graded.Max)
+		default:
+			result = time.Since(e.SubmittedAt).Truncate(time.Second).String() + " so far"
+		}
+		t.Row(e.Course, e.Assessment, fmt.Sprint(e.Version), e.State, formatTime(e.SubmittedAt), result)
+	}
+	fmt.Println(t.Render())
+}
+
+// Red if due within a day, yellow within three, green otherwise.
+func urgencyStyle(due time.Time) lipgloss.Style {
+	switch left := time.Until(due); {
+	case left < 24*time.Hour:
+		return lipgloss.NewStyle().Foreground(colorPrimary).Bold(true)
+	case left < 72*time.Hour:
+		return lipgloss.NewStyle().Foreground(colorWarning)
+	default:
+		return lipgloss.NewStyle().Foreground(colorSpecial)
+	}
+}
+
+func displayUpcoming(days int, upcoming []upcomingAssessment) {
+	var headerStyle = lipgloss.NewStyle().
+		Align(lipgloss.Left).
+		Bold(true).
+		Foreground(colorPrimary).
+		PaddingTop(1).
+		PaddingLeft(0)
+	fmt.Println(headerStyle.Render(fmt.Sprintf("Due in the next %d days:", days)))
+
+	if len(upcoming) == 0 {
+		fmt.Println(" Nothing due. Enjoy it while it lasts.")
+		return
+	}
+
+	t := table.New().
+		Headers("Due", "Course", "Assessment", "Due Date", "Closes", "Submitted").
+		Border(lipgloss.NormalBorder()).
+		StyleFunc(func(r, c int) lipgloss.Style {
+			switch {
+			case r == 0:
+				return lipgloss.NewStyle().Bold(true).Foreground(colorPrimary)
+			case c == 0 && upcoming[r-1].Error == "":
+				due, _ := autolabTime(upcoming[r-1].Due)
+				return urgencyStyle(due)
+			default:
+				return lipgloss.NewStyle()
+			}
+		})
+
+	for _, u := range upcoming {
+		if u.Error != "" {
+			t.Row("", u.Course, u.Name, errorMsg(u.Error), "", "")
+			continue
+		}
+		submitted := "no"
+		if u.Submitted() {
+			submitted = checkMark + fmt.Sprintf("(%d)", u.Submissions)
+		}
+		due, _ := autolabTime(u.Due)
+		t.Row(formatTimeAs(timeRelative, due), u.Course, u.Name, formatRawTime(u.Due), formatRawTime(u.Closed), submitted)
 	}
 	fmt.Println(t.Render())
 }
@@ -168,7 +343,10 @@ func (d Decanter) interactiveSetup() {
 		Title("Initiating device flow...").
 		Style(spinStyle).
 		Action(func() {
-			dResp, err = d.auth.DeviceAuth()
+			err = inSpan("device auth", func() (err error) {
+				dResp, err = d.auth.DeviceAuth()
+				return
+			})
 		}).Run()
 	if err != nil {
 		fmt.Println("Error starting device flow: ", err)
@@ -182,7 +360,10 @@ func (d Decanter) interactiveSetup() {
 		Type(spinner.Dots).
 		Style(spinStyle).
 		Action(func() {
-			dCode, err = d.auth.DeviceAccessCode(dResp)
+			err = inSpan("device access code", func() (err error) {
+				dCode, err = d.auth.DeviceAccessCode(dResp)
+				return
+			})
 		}).Run()
 	if err != nil || dCode == "" {
 		fmt.Println("Error getting code: ", err)
@@ -194,7 +375,10 @@ func (d Decanter) interactiveSetup() {
 		Title("Exchanging code for token...").
 		Style(spinStyle).
 		Action(func() {
-			token, err = d.auth.ExchangeCodeForToken(dCode)
+			err = inSpan("exchange code", func() (err error) {
+				token, err = d.auth.ExchangeCodeForToken(dCode)
+				return
+			})
 		}).Run()
 	if err != nil {
 		fmt.Println("Error exchanging code for token: ", err)
@@ -214,12 +398,85 @@ func (d Decanter) interactiveSetup() {
 	}
 	fmt.Println(finished("Saved token"))
 
+	if err := setTelemetryEnabled(askTelemetryConsent()); err != nil {
+		fmt.Println("Error saving telemetry settings: ", err)
+	}
+
 	finStyle := lipgloss.NewStyle().
 		Foreground(colorPrimary).Bold(true).
 		PaddingTop(1).PaddingLeft(2)
 	fmt.Println(finStyle.Render("Decanter setup complete! Try `decanter list me`"))
 }
 
+const telemetryDescription = `Decanter can send anonymous usage data to help find bugs:
+the Autolab API path of each request (with course and assessment
+names hashed), its size, and any error. No file contents, scores
+or credentials. See TELEMETRY.md.
+Everything sent is also saved to ~/.decanter/telemetry.jsonl.
+You can change your mind with 'decanter telemetry enable|disable'.`
+
+// Off unless the user says yes.
+func askTelemetryConsent() (ans bool) {
+	huh.NewConfirm().
+		Title("Share anonymous usage data?").
+		Description(telemetryDescription).
+		Value(&ans).
+		Affirmative("Yes, share").
+		Negative("No thanks").
+		WithTheme(decanterFormStyle()).
+		Run()
+	return
+}
+
+func displayTelemetryStatus(s telemetryStatus) {
+	var state string
+	switch {
+	case s.Enabled:
+		state = lipgloss.NewStyle().Foreground(colorSpecial).Render("enabled")
+	case s.Asked:
+		state = emph("disabled")
+	default:
+		state = emph("disabled") + " (you haven't opted in)"
+	}
+	fmt.Printf("Telemetry is %s.\n", state)
+	if s.DecidedAt != nil {
+		fmt.Printf("Last changed %s.\n", formatTime(*s.DecidedAt))
+	}
+	if s.Queued > 0 || s.Dropped > 0 {
+		fmt.Printf("%d events waiting to be sent, %d dropped.\n", s.Queued, s.Dropped)
+	}
+	fmt.Printf("Everything sent is logged to %s ('decanter telemetry show').\n", s.Log)
+}
+
+func displayTelemetryRecords(records []telemetryRecord) {
+	var headerStyle = lipgloss.NewStyle().
+		Align(lipgloss.Left).
+		Bold(true).
+		Foreground(colorPrimary).
+		PaddingTop(1).
+		PaddingLeft(0)
+	fmt.Println(headerStyle.Render("Telemetry Sent:"))
+
+	if len(records) == 0 {
+		fmt.Println(" Nothing has been sent.")
+		return
+	}
+
+	t := table.New().
+		Headers("Time", "Kind", "Event").
+		Border(lipgloss.NormalBorder()).
+		StyleFunc(func(r, c int) lipgloss.Style {
+			if r == 0 {
+				return lipgloss.NewStyle().Bold(true).Foreground(colorPrimary)
+			}
+			return lipgloss.NewStyle()
+		})
+	for _, r := range records {
+		t.Row(formatTime(r.Time), r.Kind, string(r.Event))
+	}
+	fmt.Println(t.Render())
+}
+
 func areYouSure(msg, affirm, neg string) (ans bool) {
 	huh.NewConfirm().
 		Title(msg).
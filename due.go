@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+// An upcoming assessment, and whether we've submitted to it.
+type upcomingAssessment struct {
+	Course string `json:"course"`
+	Autolab.AssessmentsResponse
+	Submissions int    `json:"submissions"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (u upcomingAssessment) Submitted() bool {
+	return u.Submissions > 0
+}
+
+// Assessments due in the next `days` days across courses, soonest first.
+// Assessments past due that still accept late submissions are included.
+// Submissions are fetched concurrently for each.
+func (d Decanter) fetchUpcoming(courses []Autolab.CoursesResponse, days int) []upcomingAssessment {
+	now := time.Now()
+	horizon := now.AddDate(0, 0, days)
+
+	rows := filter(d.fetchAssessments(courses), func(row courseAssessment) bool {
+		if row.Err != nil {
+			return true
+		}
+		// Error rows aside, dates were checked by fetchAssessments.
+		due, _ := autolabTime(row.Assessment.Due)
+		closed, _ := autolabTime(row.Assessment.Closed)
+		return due.Before(horizon) && (due.After(now) || closed.After(now))
+	})
+
+	return fanOut(rows, func(row courseAssessment) upcomingAssessment {
+		u := upcomingAssessment{Course: row.Course, AssessmentsResponse: row.Assessment}
+		if row.Err != nil {
+			u.Error = row.Err.Error()
+			return u
+		}
+		submissions, err := d.GetSubmissions(row.Course, row.Assessment.Name)
+		if err != nil {
+			u.Error = err.Error()
+			return u
+		}
+		u.Submissions = len(submissions)
+		return u
+	})
+}
+
+type upcomingList []upcomingAssessment
+
+func (l upcomingList) csvHeader() []string {
+	return []string{"course", "name", "display_name", "start_at", "due_at", "end_at", "category_name", "submissions", "error"}
+}
+
+func (l upcomingList) csvRows() [][]string {
+	var rows [][]string
+	for _, u := range l {
+		rows = append(rows, []string{u.Course, u.Name, u.DisplayName, u.Assigned, u.Due, u.Closed, u.Category, strconv.Itoa(u.Submissions), u.Error})
+	}
+	return rows
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+// How many courses we fetch from Autolab at once.
+// Kept small so we don't hammer the server.
+const maxConcurrentFetches = 4
+
+// A single row of the assessment list.
+// If Err is set either the course could not be fetched,
+// and Assessment is empty, or the assessment's dates are unreadable.
+type courseAssessment struct {
+	Course     string
+	Assessment Autolab.AssessmentsResponse
+	Err        error
+}
+
+// Fetch assessments for every course using a bounded pool of workers.
+// Failed courses are kept as a single row carrying the error.
+// Results are sorted by due date across all courses, with errors last.
+func (d Decanter) fetchAssessments(courses []Autolab.CoursesResponse) []courseAssessment {
+	perCourse := fanOut(courses, func(course Autolab.CoursesResponse) []courseAssessment {
+		assessments, err := d.GetUserAssessments(course.Name)
+		if err != nil {
+			return []courseAssessment{{Course: course.Name, Err: err}}
+		}
+		rows := make([]courseAssessment, 0, len(assessments))
+		for _, ass := range assessments {
+			rows = append(rows, courseAssessment{Course: course.Name, Assessment: ass, Err: checkDates(ass)})
+		}
+		return rows
+	})
+
+	var all []courseAssessment
+	for _, rows := range perCourse {
+		all = append(all, rows...)
+	}
+
+	sortByDue(all)
+	return all
+}
+
+// Everything after this relies on the dates parsing, so an assessment
+// with one we can't read is shown as an error instead of going missing.
+func checkDates(ass Autolab.AssessmentsResponse) error {
+	for _, raw := range []string{ass.Assigned, ass.Due, ass.Closed} {
+		if _, err := autolabTime(raw); err != nil {
+			return fmt.Errorf("%s: %w", ass.Name, err)
+		}
+	}
+	return nil
+}
+
+// Call f on every item, at most maxConcurrentFetches at a time.
+// Results are in the same order as items.
+func fanOut[T, R any](items []T, f func(T) R) []R {
+	results := make([]R, len(items))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	workers := min(maxConcurrentFetches, len(items))
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = f(items[j])
+			}
+		}()
+	}
+
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func sortByDue(rows []courseAssessment) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if (a.Err != nil) != (b.Err != nil) {
+			return a.Err == nil
+		}
+		if a.Err != nil {
+			return a.Course < b.Course
+		}
+		// Assessments without a due date go last
+		aDue, _ := autolabTime(a.Assessment.Due)
+		bDue, _ := autolabTime(b.Assessment.Due)
+		if aDue.IsZero() != bDue.IsZero() {
+			return bDue.IsZero()
+		}
+		return aDue.Before(bDue)
+	})
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Set by --trace-http; every request to Autolab is recorded
+// and written out as a HAR file when we exit.
+var httpRecorder *HARRecorder
+
+// Bodies beyond this are cut short (uploads can be big).
+const harBodyLimit = 64 << 10
+
+const redacted = "REDACTED"
+
+// Never written to a HAR file.
+var (
+	secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+	secretParams  = []string{"access_token", "refresh_token", "client_secret", "code"}
+)
+
+// Just enough of HAR 1.2 for browser devtools to open it.
+// http://www.softwareishard.com/blog/har-12-spec/
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// We only know when the headers arrived, so that's all wait.
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type HARRecorder struct {
+	file    string
+	mu      sync.Mutex
+	entries []*harEntry
+	// Request bodies are read by the transport as it sends,
+	// so they're only filled in when we write the file.
+	pending []func()
+}
+
+func NewHARRecorder(file string) *HARRecorder {
+	return &HARRecorder{file: file}
+}
+
+// Record each request and its response, with secrets redacted.
+// Streamed request bodies are copied as the transport sends them,
+// so uploads stay streamed; replayable ones are read up front.
+func (h *HARRecorder) Layer() Layer {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			entry := &harEntry{
+				StartedDateTime: start.Format(time.RFC3339Nano),
+				Request:         newHARRequest(req),
+			}
+
+			var sent *cappedBuffer
+			if req.Body != nil && req.Body != http.NoBody {
+				sent = &cappedBuffer{}
+				if req.GetBody != nil {
+					// The transport may send a replayable body more than
+					// once (i.e. on a reused connection that had closed),
+					// and a tee would only catch the first, partial, try.
+					if body, err := req.GetBody(); err == nil {
+						io.Copy(sent, body)
+						body.Close()
+					}
+				} else {
+					req = req.Clone(req.Context())
+					req.Body = teeReadCloser{req.Body, sent}
+				}
+			}
+
+			resp, err := next.RoundTrip(req)
+			elapsed := msSince(start)
+			entry.Time = elapsed
+			entry.Timings = harTimings{Wait: elapsed}
+			if err != nil {
+				entry.Response = harResponse{Cookies: []harNameValue{}, Headers: []harNameValue{}, HeadersSize: -1, BodySize: -1}
+				entry.Comment = err.Error()
+			} else {
+				entry.Response, resp.Body = newHARResponse(resp)
+			}
+
+			h.mu.Lock()
+			h.entries = append(h.entries, entry)
+			if sent != nil {
+				h.pending = append(h.pending, func() {
+					entry.Request.PostData = newHARPostData(req, sent)
+					entry.Request.BodySize = sent.total
+				})
+			}
+			h.mu.Unlock()
+			return resp, err
+		})
+	}
+}
+
+func (h *HARRecorder) Write() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, fill := range h.pending {
+		fill()
+	}
+
+	har := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "decanter", Version: "1"},
+		Entries: make([]harEntry, 0, len(h.entries)),
+	}}
+	for _, e := range h.entries {
+		har.Log.Entries = append(har.Log.Entries, *e)
+	}
+	b, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(h.file, b, 0600)
+}
+
+func newHARRequest(req *http.Request) harRequest {
+	u := redactURL(req.URL)
+	query := []harNameValue{}
+	for name, values := range u.Query() {
+		for _, v := range values {
+			query = append(query, harNameValue{name, v})
+		}
+	}
+	return harRequest{
+		Method:      req.Method,
+		URL:         u.String(),
+		HTTPVersion: req.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(req.Header),
+		QueryString: query,
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+}
+
+func newHARPostData(req *http.Request, sent *cappedBuffer) *harPostData {
+	sent.mu.Lock()
+	defer sent.mu.Unlock()
+	data := &harPostData{MimeType: req.Header.Get("Content-Type"), Text: sent.buf.String()}
+	// i.e. the token refresh, which sends refresh_token in the body.
+	if data.MimeType == "application/x-www-form-urlencoded" {
+		data.Text = redactForm(data.Text)
+	}
+	if sent.truncated() {
+		data.Comment = "truncated"
+	}
+	return data
+}
+
+// Returns the body to use in place of resp.Body,
+// since we read (at most harBodyLimit of) it here.
+func newHARResponse(resp *http.Response) (harResponse, io.ReadCloser) {
+	head, err := io.ReadAll(io.LimitReader(resp.Body, harBodyLimit+1))
+	body := readCloser{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	content := harContent{
+		Size:     int64(len(head)),
+		MimeType: resp.Header.Get("Content-Type"),
+		Text:     string(head[:min(len(head), harBodyLimit)]),
+	}
+	if len(head) > harBodyLimit {
+		content.Size = resp.ContentLength
+		content.Comment = "truncated"
+	}
+	if err != nil {
+		content.Comment = "error reading body: " + err.Error()
+	}
+
+	return harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(resp.Header),
+		Content:     content,
+		HeadersSize: -1,
+		BodySize:    resp.ContentLength,
+	}, body
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	h = h.Clone()
+	for _, name := range secretHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, redacted)
+		}
+	}
+	headers := []harNameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			headers = append(headers, harNameValue{name, v})
+		}
+	}
+	return headers
+}
+
+func redactURL(u *neturl.URL) *neturl.URL {
+	redactedURL := *u
+	redactedURL.User = nil
+	redactedURL.RawQuery = redactForm(u.RawQuery)
+	return &redactedURL
+}
+
+// Redact secretParams in a query string or form body.
+func redactForm(s string) string {
+	values, err := neturl.ParseQuery(s)
+	if err != nil {
+		// Can't tell what's in it, so keep none of it.
+		return redacted
+	}
+	for _, name := range secretParams {
+		if values.Has(name) {
+			values.Set(name, redacted)
+		}
+	}
+	return values.Encode()
+}
+
+func msSince(t time.Time) float64 {
+	return float64(time.Since(t).Microseconds()) / 1000
+}
+
+// Keeps the first harBodyLimit bytes written, and counts the rest.
+type cappedBuffer struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	total int64
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if room := harBodyLimit - c.buf.Len(); room > 0 {
+		c.buf.Write(p[:min(len(p), room)])
+	}
+	c.total += int64(len(p))
+	return len(p), nil
+}
+
+func (c *cappedBuffer) truncated() bool {
+	return c.total > harBodyLimit
+}
+
+type teeReadCloser struct {
+	rc io.ReadCloser
+	w  io.Writer
+}
+
+func (t teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.rc.Read(p)
+	if n > 0 {
+		t.w.Write(p[:n])
+	}
+	return n, err
+}
+
+func (t teeReadCloser) Close() error {
+	return t.rc.Close()
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The HAR file written for the requests do makes over base,
+// recorded as they would be with --trace-http.
+func recordHAR(t *testing.T, base http.RoundTripper, do func(client *http.Client)) (harFile, string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "trace.har")
+	recorder := NewHARRecorder(file)
+	do(&http.Client{Transport: Chain(base, recorder.Layer())})
+	if err := recorder.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har harFile
+	if err := json.Unmarshal(b, &har); err != nil {
+		t.Fatal(err)
+	}
+	return har, string(b)
+}
+
+func TestHARRedactsSecrets(t *testing.T) {
+	big := strings.Repeat("x", harBodyLimit+100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "cookie-value"})
+		if r.URL.Path == "/big" {
+			io.WriteString(w, big)
+			return
+		}
+		io.WriteString(w, `{"ok": true}`)
+	}))
+	defer server.Close()
+
+	var bigBody string
+	har, raw := recordHAR(t, http.DefaultTransport, func(client *http.Client) {
+		req := newTestRequest(http.MethodGet, server.URL+"/api/v1/user?access_token=ya29.access-token&refresh_token=1//refresh-token&page=2")
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+		req = newTestRequest(http.MethodPost, server.URL+"/oauth/device_flow_authorize?code=device-code-8c1f")
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+		// The token refresh, as the oauth2 package sends it.
+		req, _ = http.NewRequest(http.MethodPost, server.URL+"/oauth/token",
+			strings.NewReader("grant_type=refresh_token&refresh_token=1%2F%2Frefresh-token&client_secret=s3cret"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+		req = newTestRequest(http.MethodGet, server.URL+"/big")
+		if resp, err := client.Do(req); err == nil {
+			b, _ := io.ReadAll(resp.Body)
+			bigBody = string(b)
+			resp.Body.Close()
+		}
+	})
+
+	if len(har.Log.Entries) != 4 {
+		t.Fatalf("recorded %d entries, want 4", len(har.Log.Entries))
+	}
+	for _, s := range append(secrets, "s3cret", "1%2F%2Frefresh-token") {
+		if strings.Contains(raw, s) {
+			t.Errorf("%q was written to the HAR file", s)
+		}
+	}
+	if n := strings.Count(raw, redacted); n == 0 {
+		t.Error("nothing was redacted")
+	}
+	// Everything else is kept.
+	user := har.Log.Entries[0].Request
+	if !strings.Contains(user.URL, "page=2") {
+		t.Errorf("url = %q, want page=2 kept", user.URL)
+	}
+	for _, h := range append(user.Headers, har.Log.Entries[0].Response.Headers...) {
+		switch h.Name {
+		case "Authorization", "Cookie", "Set-Cookie":
+			if h.Value != redacted {
+				t.Errorf("%s = %q, want %s", h.Name, h.Value, redacted)
+			}
+		}
+	}
+	refresh := har.Log.Entries[2].Request.PostData
+	if refresh == nil || !strings.Contains(refresh.Text, "grant_type=refresh_token") {
+		t.Errorf("token refresh body = %+v, want it kept, less the secrets", refresh)
+	}
+
+	// Bodies are capped, but the caller still gets all of it.
+	content := har.Log.Entries[3].Response.Content
+	if len(content.Text) != harBodyLimit || content.Comment != "truncated" {
+		t.Errorf("recorded %d bytes (%q), want %d, truncated", len(content.Text), content.Comment, harBodyLimit)
+	}
+	if bigBody != big {
+		t.Errorf("caller got %d bytes, want %d", len(bigBody), len(big))
+	}
+}
+
+func TestHARRequestBodies(t *testing.T) {
+	upload := strings.Repeat("handin", harBodyLimit)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer server.Close()
+
+	// As if the transport's first try failed partway and it replayed the body.
+	replaying := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.GetBody != nil {
+			io.CopyN(io.Discard, req.Body, 3)
+			req.Body.Close()
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	har, _ := recordHAR(t, replaying, func(client *http.Client) {
+		post := func(body io.Reader) {
+			resp, err := client.Post(server.URL+"/submit", "text/plain", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+		post(strings.NewReader("replayable"))
+		// Streamed, like SubmitFile's uploads: no GetBody.
+		post(io.MultiReader(strings.NewReader("stre"), strings.NewReader("amed")))
+		post(io.MultiReader(strings.NewReader(upload)))
+	})
+
+	tests := []struct {
+		text      string
+		size      int
+		truncated bool
+	}{
+		{"replayable", 10, false},
+		{"streamed", 8, false},
+		{upload[:harBodyLimit], len(upload), true},
+	}
+	if len(har.Log.Entries) != len(tests) {
+		t.Fatalf("recorded %d entries, want %d", len(har.Log.Entries), len(tests))
+	}
+	for i, tt := range tests {
+		req := har.Log.Entries[i].Request
+		if req.PostData == nil {
+			t.Errorf("entry %d has no body", i)
+			continue
+		}
+		if req.PostData.Text != tt.text || req.BodySize != int64(tt.size) {
+			t.Errorf("entry %d body = %d bytes %.20q..., want %d bytes %.20q...", i, req.BodySize, req.PostData.Text, tt.size, tt.text)
+		}
+		if (req.PostData.Comment == "truncated") != tt.truncated {
+			t.Errorf("entry %d comment = %q, want truncated: %v", i, req.PostData.Comment, tt.truncated)
+		}
+	}
+}
+
+func TestHARRecordsFailures(t *testing.T) {
+	failing := RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	har, _ := recordHAR(t, failing, func(client *http.Client) {
+		if _, err := client.Get("http://autolab.test/api/v1/user"); err == nil {
+			t.Fatal("expected the request to fail")
+		}
+	})
+	if len(har.Log.Entries) != 1 || !strings.Contains(har.Log.Entries[0].Comment, "connection refused") {
+		t.Errorf("entries = %+v, want one noting the error", har.Log.Entries)
+	}
+}
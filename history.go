@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+// Every version of a submission, with the best one marked.
+type submissionHistory []submissionOutput
+
+func newSubmissionHistory(submissions []Autolab.SubmissionsResponse) submissionHistory {
+	h := make(submissionHistory, 0, len(submissions))
+	best := -1
+	for i, sub := range submissions {
+		out := newSubmissionOutput(sub)
+		h = append(h, out)
+		// Ties go to the latest version
+		if best < 0 || out.Total > h[best].Total ||
+			(out.Total == h[best].Total && out.Version > h[best].Version) {
+			best = i
+		}
+	}
+	if best >= 0 {
+		h[best].Best = true
+	}
+	return h
+}
+
+// Sort the history in place. Newest/highest first.
+func (h submissionHistory) sortBy(field string) error {
+	var less func(a, b submissionOutput) bool
+	switch field {
+	case "", "version":
+		less = func(a, b submissionOutput) bool { return a.Version > b.Version }
+	case "score", "total":
+		less = func(a, b submissionOutput) bool { return a.Total > b.Total }
+	case "time", "submitted":
+		less = func(a, b submissionOutput) bool {
+			// Unreadable times go last.
+			aTime, aErr := autolabTime(a.Submitted)
+			bTime, bErr := autolabTime(b.Submitted)
+			if (aErr != nil) != (bErr != nil) {
+				return bErr != nil
+			}
+			return aTime.After(bTime)
+		}
+	default:
+		return fmt.Errorf("can't sort by %q (options: version|score|time)", field)
+	}
+	sort.SliceStable(h, func(i, j int) bool { return less(h[i], h[j]) })
+	return nil
+}
+
+func (h submissionHistory) withMax(maxScores map[string]float64) submissionHistory {
+	for i := range h {
+		h[i] = h[i].withMax(maxScores)
+	}
+	return h
+}
+
+func (h submissionHistory) version(v int) (submissionOutput, bool) {
+	for _, sub := range h {
+		if sub.Version == v {
+			return sub, true
+		}
+	}
+	return submissionOutput{}, false
+}
+
+// Keep the first n entries; n <= 0 keeps everything.
+func (h submissionHistory) limit(n int) submissionHistory {
+	if n <= 0 || n >= len(h) {
+		return h
+	}
+	return h[:n]
+}
+
+// Every problem that appears in any version.
+func (h submissionHistory) problems() []string {
+	seen := map[string]bool{}
+	var problems []string
+	for _, sub := range h {
+		for _, p := range sub.problems() {
+			if !seen[p] {
+				seen[p] = true
+				problems = append(problems, p)
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func (h submissionHistory) csvHeader() []string {
+	return append([]string{"version", "filename", "created_at", "total", "max", "best"}, h.problems()...)
+}
+
+func (h submissionHistory) csvRows() [][]string {
+	problems := h.problems()
+	var rows [][]string
+	for _, sub := range h {
+		row := []string{strconv.Itoa(sub.Version), sub.Filename, sub.Submitted, formatFloat(sub.Total), formatMax(sub.Max), strconv.FormatBool(sub.Best)}
+		for _, p := range problems {
+			row = append(row, formatScore(sub.Scores[p]))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+func submission(version int, submitted string, scores Autolab.Scores) Autolab.SubmissionsResponse {
+	return Autolab.SubmissionsResponse{Version: version, Filename: "handin.tar", Submitted: submitted, Scores: scores}
+}
+
+var pending = Autolab.Score{State: Autolab.ScoreUnreleased}
+
+func TestSubmissionHistoryBest(t *testing.T) {
+	tests := []struct {
+		name     string
+		subs     []Autolab.SubmissionsResponse
+		wantBest int
+	}{
+		{"highest total", []Autolab.SubmissionsResponse{
+			submission(1, "", Autolab.Scores{"a": Autolab.ReleasedScore(5)}),
+			submission(2, "", Autolab.Scores{"a": Autolab.ReleasedScore(9)}),
+			submission(3, "", Autolab.Scores{"a": Autolab.ReleasedScore(7)}),
+		}, 2},
+		{"ties go to the latest", []Autolab.SubmissionsResponse{
+			submission(3, "", Autolab.Scores{"a": Autolab.ReleasedScore(8)}),
+			submission(1, "", Autolab.Scores{"a": Autolab.ReleasedScore(8)}),
+			submission(2, "", Autolab.Scores{"a": Autolab.ReleasedScore(8)}),
+		}, 3},
+		{"unreleased scores count for nothing", []Autolab.SubmissionsResponse{
+			submission(1, "", Autolab.Scores{"a": Autolab.ReleasedScore(4), "b": Autolab.ReleasedScore(1)}),
+			submission(2, "", Autolab.Scores{"a": Autolab.ReleasedScore(4), "b": pending}),
+		}, 1},
+		{"missing problems count for nothing", []Autolab.SubmissionsResponse{
+			submission(1, "", Autolab.Scores{"a": Autolab.ReleasedScore(4), "b": Autolab.ReleasedScore(1)}),
+			submission(2, "", Autolab.Scores{"a": Autolab.ReleasedScore(4), "b": {}}),
+			submission(3, "", Autolab.Scores{"a": Autolab.ReleasedScore(4)}),
+		}, 1},
+		{"nothing graded yet", []Autolab.SubmissionsResponse{
+			submission(1, "", Autolab.Scores{"a": pending}),
+			submission(2, "", Autolab.Scores{"a": pending}),
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var best []int
+			for _, sub := range newSubmissionHistory(tt.subs) {
+				if sub.Best {
+					best = append(best, sub.Version)
+				}
+			}
+			if !reflect.DeepEqual(best, []int{tt.wantBest}) {
+				t.Errorf("best = %v, want [%d]", best, tt.wantBest)
+			}
+		})
+	}
+
+	if h := newSubmissionHistory(nil); len(h) != 0 {
+		t.Errorf("history of nothing = %v, want empty", h)
+	}
+}
+
+func TestSubmissionHistorySort(t *testing.T) {
+	subs := []Autolab.SubmissionsResponse{
+		submission(1, "2024-03-01T10:00:00.000-05:00", Autolab.Scores{"a": Autolab.ReleasedScore(6)}),
+		submission(2, "yesterday", Autolab.Scores{"a": Autolab.ReleasedScore(9)}),
+		submission(3, "2024-03-02T10:00:00.000-05:00", Autolab.Scores{"a": Autolab.ReleasedScore(3)}),
+	}
+	tests := []struct {
+		field   string
+		want    []int
+		wantErr bool
+	}{
+		{"", []int{3, 2, 1}, false},
+		{"version", []int{3, 2, 1}, false},
+		{"score", []int{2, 1, 3}, false},
+		// Unreadable times go last.
+		{"time", []int{3, 1, 2}, false},
+		{"filename", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			h := newSubmissionHistory(subs)
+			err := h.sortBy(tt.field)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got []int
+			for _, sub := range h {
+				got = append(got, sub.Version)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("versions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Problems added or dropped between versions get their own
+// column, left empty where a version doesn't have them.
+func TestSubmissionHistoryCSV(t *testing.T) {
+	h := newSubmissionHistory([]Autolab.SubmissionsResponse{
+		submission(2, "t2", Autolab.Scores{"a": Autolab.ReleasedScore(2.5), "c": pending}),
+		submission(1, "t1", Autolab.Scores{"a": Autolab.ReleasedScore(1), "b": Autolab.ReleasedScore(2), "c": {}}),
+	})
+
+	wantHeader := []string{"version", "filename", "created_at", "total", "max", "best", "a", "b", "c"}
+	if got := h.csvHeader(); !reflect.DeepEqual(got, wantHeader) {
+		t.Errorf("header = %q, want %q", got, wantHeader)
+	}
+	wantRows := [][]string{
+		{"2", "handin.tar", "t2", "2.5", "", "false", "2.5", "", "unreleased"},
+		{"1", "handin.tar", "t1", "3", "", "true", "1", "2", ""},
+	}
+	if got := h.csvRows(); !reflect.DeepEqual(got, wantRows) {
+		t.Errorf("rows = %q, want %q", got, wantRows)
+	}
+}
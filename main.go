@@ -1,15 +1,19 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/speedata/optionparser"
 
 	"github.com/charmbracelet/huh"
-	"github.com/charmbracelet/huh/spinner"
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/p5quared/decanter/Autolab"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // By default, we're running in production mode. Yee haw!
@@ -23,9 +27,19 @@ const ( // I was told it was okay to put these here... :p
 
 // Big TODO: Caching user datda (like courses and due dates)
 func main() {
+	// Set to exit with a failure once everything deferred has run
+	// (traces, telemetry and the HAR file all flush in defers).
+	var exitCode int
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	if PROD != "TRUE" {
 		exclaim := lipgloss.NewStyle().Foreground(colorPrimary).Bold(true).Render
-		fmt.Println(exclaim("RUNNING IN DEBUG MODE"))
+		// On stderr so it never ends up in -o json output.
+		fmt.Fprintln(os.Stderr, exclaim("RUNNING IN DEBUG MODE"))
 	}
 
 	op := optionparser.NewOptionParser()
@@ -39,30 +53,141 @@ func main() {
 	op.On("-c NAME", "--course NAME", "Specify a course. -c cse476-s25", &course)
 
 	var wait bool
-	op.On("-w", "--wait", "Waits for additional info (if applicable). ex: 'submit -w' will wait for and display results. (NOT CURRENTLY IMPLEMENTED)", &wait)
+	op.On("-w", "--wait", "Waits for additional info (if applicable). ex: 'submit -w' will wait for and display results.", &wait)
+
+	var waitTimeout string
+	op.On("--wait-timeout DURATION", "How long to wait for grading. --wait-timeout 15m (default: 10m)", &waitTimeout)
+
+	var detach bool
+	op.On("-d", "--detach", "Submit and watch for results in the background. See 'decanter status'.", &detach)
+
+	var notify bool
+	op.On("-n", "--notify", "Send a notification when grading finishes (submit --wait, watch).", &notify)
 
 	var all bool
 	op.On("--all", "Display all (extra) data.", &all)
 
+	var semester string
+	op.On("-s NAME", "--semester NAME", "List courses from a specific semester. -s f24 (default: current)", &semester)
+
+	var versionStr string
+	op.On("--version N", "Use a specific submission version. --version 3", &versionStr)
+
+	var daysStr string
+	op.On("--days N", "How many days ahead to look for deadlines. --days 14 (default: 7)", &daysStr)
+
+	var limitStr string
+	op.On("--limit N", "Only list the first N entries.", &limitStr)
+
+	var sortBy string
+	op.On("--sort FIELD", "Sort submissions by version|score|time (default: version)", &sortBy)
+
+	var timeStyleStr string
+	op.On("--time-style STYLE", "How to show times: absolute|relative|iso (default: absolute)", &timeStyleStr)
+
+	var outputStr string
+	op.On("-o FORMAT", "--output FORMAT", "Output format: json|yaml|csv|table (default: table)", &outputStr)
+
+	var outFile string
+	op.On("--out FILE", "Write to a file instead of stdout (calendar export). --out deadlines.ics (-o is --output)", &outFile)
+
+	var addr string
+	op.On("--addr ADDR", "Address to serve on (calendar serve). --addr localhost:8765", &addr)
+
+	var debug bool
+	op.On("--debug", "Log every request to Autolab (to stderr).", &debug)
+
+	var traceHTTP string
+	op.On("--trace-http FILE", "Record requests to Autolab as a HAR file, i.e. for bug reports. --trace-http decanter.har", &traceHTTP)
+
 	var interactive bool
 	op.On("-i", "--interactive", "Run in interactive mode.", &interactive)
 
 	op.Command("setup", "Setup (authorize) a new device (you should only need to do this once).")
 	op.Command("submit", "Submit to an assessment.Available flags: --course, --assessment, --file, --wait")
 	op.Command("list", "List data. Args: courses|assessments|submissions|me")
+	op.Command("watch", "Wait for a submission to be graded. Available flags: --course, --assessment, --version (default: latest)")
+	op.Command("status", "Show submissions being watched in the background (submit --detach).")
+	op.Command("daemon", "Watch queued submissions until they're graded (started automatically).")
+	op.Command("due", "Show upcoming deadlines across your current courses. Available flags: --days")
+	op.Command("calendar", "Export deadlines as an iCalendar file. Args: export|serve. Available flags: --out FILE (not -o), --addr")
+	op.Command("telemetry", "Show or change what usage data is shared. Args: status|enable|disable|show. Available flags: --limit")
+	op.Command("diff", "Compare scores between two submission versions. Args: [v1] [v2] (default: previous vs latest)")
 
 	err := op.Parse()
 	if err != nil {
-		fmt.Println(errorMsg(err.Error()))
+		printError(err.Error())
 		return
 	}
 	ex := op.Extra
 	if len(ex) == 0 {
-		fmt.Println(errorMsg("No command specified."))
+		printError("No command specified.")
+		return
+	}
+	if outputStr != "" {
+		output, err = parseOutputFormat(outputStr)
+		if err != nil {
+			printError(err.Error())
+			return
+		}
+	}
+
+	var timeout time.Duration
+	if waitTimeout != "" {
+		timeout, err = time.ParseDuration(waitTimeout)
+		if err != nil {
+			printError("--wait-timeout expects a duration, i.e. 15m.")
+			return
+		}
+	}
+
+	conf, err := LoadConfig()
+	if err != nil {
+		printError("Could not read config, using defaults.\n" + err.Error())
+	}
+	if err := setDisplayLocation(conf.Timezone); err != nil {
+		printError("Unknown timezone in config, using local time.\n" + err.Error())
+	}
+	if timeStyleStr == "" {
+		timeStyleStr = conf.TimeStyle
+	}
+	if timeStyleStr != "" {
+		displayStyle, err = parseTimeStyle(timeStyleStr)
+		if err != nil {
+			printError(err.Error())
+			return
+		}
+	}
+	shutdownTracing, err := setupTracing(conf.Tracing)
+	if err != nil {
+		printError("Tracing is off.\n" + err.Error())
+	}
+	defer shutdownTracing()
+	endSpan := startCommandSpan(ex,
+		attribute.String("decanter.course", course),
+		attribute.String("decanter.assessment", assessment),
+	)
+	defer endSpan()
+
+	debugHTTP = debug
+	if traceHTTP != "" {
+		httpRecorder = NewHARRecorder(traceHTTP)
+		defer func() {
+			if err := httpRecorder.Write(); err != nil {
+				printError("Could not write " + traceHTTP + ".\n" + err.Error())
+			}
+		}()
+	}
+
+	// Before NewDecanter, which starts sending telemetry (and whatever
+	// is spooled), so `telemetry disable` really sends nothing more.
+	if ex[0] == "telemetry" {
+		runTelemetryCommand(ex[1:], limitStr)
 		return
 	}
 
-	decanter := NewDecanter()
+	decanter := NewDecanter(conf)
+	defer flushTelemetry()
 
 	if ex[0] == "setup" {
 		if decanter.tokenExists() {
@@ -75,7 +200,7 @@ func main() {
 	}
 	// check that we have a token
 	if !decanter.tokenExists() {
-		fmt.Println(errorMsg("No token found. Please run 'decanter setup' to authorize this device."))
+		printError("No token found. Please run 'decanter setup' to authorize this device.")
 		return
 	}
 
@@ -124,147 +249,369 @@ func main() {
 			return // User cancelled
 		}
 
-		// Retrieve the last submitted version before submitting,
-		// we will wait for version + 1.
-		var submissions []Autolab.SubmissionsResponse
-		spinner.New().
-			Style(spinStyle).
-			Title("Fetching submissions...").
-			Action(func() {
-				submissions, err = decanter.GetSubmissions(course, assessment)
-			}).Run()
+		hash, err := hashFile(file)
 		if err != nil {
-			errStr := fmt.Sprintf("Something went wrong while fetching submissions. \nCheck your arguments:\nCourse: %s\nAssessment: %s", course, assessment)
-			fmt.Println(errorMsg(errStr))
+			printError("Could not read " + file + ".\n" + err.Error())
 			return
 		}
-
-		var lastSubVersion int
-		for _, sub := range submissions {
-			if sub.Version > lastSubVersion {
-				lastSubVersion = sub.Version
+		if prev := newSubmitLog().previousVersion(course, assessment, hash); prev > 0 {
+			printWarning(fmt.Sprintf("%s is identical to version %d.", file, prev))
+			if isTTY && !structuredOutput() && !areYouSure("Submit the same file again?", "Submit", "Abort") {
+				return
 			}
 		}
 
 		tStr := fmt.Sprintf("Submitting %s to %s...", file, assessment)
-		var err error
-		spinner.New().
-			Title(tStr).
-			Style(spinStyle).
-			Action(func() {
-				_, err = decanter.SubmitFile(course, assessment, file)
-			}).Run()
+		var result submitOutput
+		uploadErr := withUploadProgress(tStr, func(opts Autolab.SubmitOptions) {
+			result, err = decanter.submit(course, assessment, file, hash, opts)
+		})
+		if errors.Is(uploadErr, errUploadInterrupted) {
+			printError("Upload interrupted. Run the same submit again to check whether it went through.")
+			exitCode = 130
+			return
+		}
 		if err != nil {
 			// Not sure why, but we need this, otherwise the text is getting pushed over.
-			fmt.Println()
-			fmt.Println(errorMsg("Decanter could not submit.") + "\n" + err.Error())
+			fmt.Fprintln(os.Stderr)
+			printError("Decanter could not submit.\n" + err.Error())
 			return
-		} else {
+		} else if !structuredOutput() {
 			var emphasis = lipgloss.NewStyle().Bold(true).Foreground(colorPrimary).Render
-			fmt.Printf("%s %s to %s!\n", finished("Successfully submit"), emphasis(file), emphasis(assessment))
+			if result.Recovered {
+				fmt.Printf("%s %s to %s already went through. (version %d)\n", finished("Your last upload of"), emphasis(file), emphasis(assessment), result.Version)
+			} else {
+				fmt.Printf("%s %s to %s! (version %d)\n", finished("Successfully submit"), emphasis(file), emphasis(assessment), result.Version)
+			}
+		}
+
+		if detach {
+			err = newSubmissionQueue().Add(queuedSubmission{
+				Course:      course,
+				Assessment:  assessment,
+				Version:     result.Version,
+				File:        file,
+				Notify:      notify,
+				SubmittedAt: time.Now(),
+				UpdatedAt:   time.Now(),
+				State:       Autolab.WatchQueued.String(),
+			})
+			if err == nil {
+				err = startDaemon()
+			}
+			if err != nil {
+				printError("Could not queue submission for grading.\n" + err.Error())
+				return
+			}
+			status("Watching for results in the background. See 'decanter status'.")
+			show(result, func() {})
+			return
 		}
 
 		if wait {
-			var latest Autolab.SubmissionsResponse
-			spinner.New().
-				Style(spinStyle).
-				Title(fmt.Sprintf("Waiting for grading of version %d...", lastSubVersion)).
-				Action(func() {
-					latest, err = decanter.PollLatestSubmission(course, assessment, lastSubVersion)
-				}).Run()
+			// Wait for exactly the version we just submitted,
+			// in case someone else (i.e. a teammate) submits too.
+			decanter.watchAndShow(result, timeout, notify)
+			return
+		}
+		show(result, func() {})
+	case "watch":
+		if course == "" || assessment == "" {
+			printError("To watch a submission, please pass a course and assessment.")
+			return
+		}
+		result := submitOutput{Course: course, Assessment: assessment}
+		if versionStr != "" {
+			result.Version, err = strconv.Atoi(versionStr)
+			if err != nil {
+				printError("--version expects a number.")
+				return
+			}
+		} else {
+			// Default to the latest version
+			var submissions []Autolab.SubmissionsResponse
+			withSpinner("Fetching submissions...", func() {
+				submissions, err = decanter.GetSubmissions(course, assessment)
+			})
+			if err != nil {
+				errStr := fmt.Sprintf("Something went wrong while fetching submissions. \nCheck your arguments:\nCourse: %s\nAssessment: %s", course, assessment)
+				printError(errStr)
+				return
+			}
+			for _, sub := range submissions {
+				if sub.Version > result.Version {
+					result.Version = sub.Version
+				}
+			}
+			if result.Version == 0 {
+				printError(fmt.Sprintf("No submissions found for %s.", assessment))
+				return
+			}
+		}
+		decanter.watchAndShow(result, timeout, notify)
+	case "due":
+		days := 7
+		if daysStr != "" {
+			days, err = strconv.Atoi(daysStr)
+			if err != nil || days < 1 {
+				printError("--days expects a positive number.")
+				return
+			}
+		}
+		var upcoming []upcomingAssessment
+		withSpinner("Fetching deadlines...", func() {
+			var courses []Autolab.CoursesResponse
+			courses, err = decanter.GetUserCourses()
+			if err != nil {
+				return
+			}
+			_, courses = decanter.coursesIn(semester, courses)
+			upcoming = decanter.fetchUpcoming(courses, days)
+		})
+		if err != nil {
+			printError("Something went wrong while fetching courses.\n" + err.Error())
+			return
+		}
+		status("Fetched deadlines")
+		show(upcomingList(upcoming), func() { displayUpcoming(days, upcoming) })
+	case "calendar":
+		if len(ex) < 2 {
+			printError("Invalid Usage: Please specify a calendar action.\nex: decanter calendar export|serve")
+			return
+		}
+		switch ex[1] {
+		case "export":
+			var rows []courseAssessment
+			withSpinner("Fetching assessments...", func() {
+				rows, err = decanter.calendarRows(semester, all)
+			})
 			if err != nil {
-				errStr := fmt.Sprintf("Something went wrong while waiting for grading.\n%s", err.Error())
-				fmt.Println(errorMsg(errStr))
+				printError("Something went wrong while fetching courses.\n" + err.Error())
+				return
+			}
+			for _, row := range rows {
+				if row.Err != nil {
+					printWarning(fmt.Sprintf("Left out of the calendar: %s: %s", row.Course, row.Err))
+				}
+			}
+			ics := buildCalendar(rows, time.Now())
+			if outFile == "" {
+				fmt.Print(ics)
+				return
+			}
+			if err := os.WriteFile(outFile, []byte(ics), 0644); err != nil {
+				printError("Could not write calendar.\n" + err.Error())
 				return
 			}
-			fmt.Println(finished("Submission graded"))
-			displaySubmission(latest)
+			status(fmt.Sprintf("Wrote %s", outFile))
+		case "serve":
+			if addr == "" {
+				addr = "localhost:8765"
+			}
+			status(fmt.Sprintf("Serving calendar at http://%s/decanter.ics (ctrl+c to stop)", addr))
+			if err := decanter.serveCalendar(addr, semester, all); err != nil {
+				printError(err.Error())
+			}
+		default:
+			printError("Invalid calendar action.\nOptions: export|serve")
+		}
+	case "daemon":
+		if err := decanter.runDaemon(commandCtx); err != nil {
+			printError(err.Error())
+		}
+	case "status":
+		entries, err := newSubmissionQueue().Load()
+		if err != nil {
+			printError("Could not read the submission queue.\n" + err.Error())
+			return
+		}
+		pending := filter(entries, func(q queuedSubmission) bool { return !q.done() })
+		// The daemon exits when it runs out of work, so it may need a nudge.
+		if len(pending) > 0 && !daemonRunning() {
+			if err := startDaemon(); err != nil {
+				printError("Could not start the daemon.\n" + err.Error())
+			}
+		}
+		if !all {
+			entries = filter(entries, func(q queuedSubmission) bool {
+				return !q.done() || time.Since(q.UpdatedAt) < 24*time.Hour
+			})
+		}
+		show(queueList(entries), func() { displayQueue(entries) })
+	case "diff":
+		if course == "" || assessment == "" {
+			printError("To compare submissions, please pass a course and assessment.")
+			return
+		}
+		var submissions []Autolab.SubmissionsResponse
+		withSpinner("Fetching submissions...", func() {
+			submissions, err = decanter.GetSubmissions(course, assessment)
+		})
+		if err != nil {
+			errStr := fmt.Sprintf("Something went wrong while fetching submissions. \nCheck your arguments:\nCourse: %s\nAssessment: %s", course, assessment)
+			printError(errStr)
+			return
+		}
+
+		from, to, err := pickDiffVersions(submissions, ex[1:])
+		if err != nil {
+			printError(err.Error())
+			return
 		}
+		d := diffSubmissions(from, to)
+		show(d, func() { displayScoreDiff(d) })
 	case "list":
 		if len(ex) < 2 {
-			fmt.Println("Invalid Usage: Please specify a list group.\nex: decanter list courses|assessments|me")
+			printError("Invalid Usage: Please specify a list group.\nex: decanter list courses|assessments|me")
 			return
 		}
 		switch ex[1] {
 		case "courses":
 			var courses []Autolab.CoursesResponse
-			spinner.New().
-				Title("Fetching course data...").
-				Style(spinStyle).
-				Action(func() {
-					courses, _ = decanter.GetUserCourses()
-				}).Run()
+			withSpinner("Fetching course data...", func() {
+				courses, err = decanter.GetUserCourses()
+			})
+			if err != nil {
+				printError("Something went wrong while fetching courses.\n" + err.Error())
+				return
+			}
 
 			// Default: Only show current semester
+			heading := "all semesters"
 			if !all {
-				courses = filterCourses(courses, func(c Autolab.CoursesResponse) bool {
-					return c.Semester == "s25"
-				})
+				heading, courses = decanter.coursesIn(semester, courses)
 			}
 
-			fmt.Println(finished("Fetched course data"))
-			displayCourseList(courses)
+			status("Fetched course data")
+			show(courseList(courses), func() { displayCourseList(heading, courses) })
 		case "assessments", "ass":
-			var courses []Autolab.CoursesResponse
-			spinner.New().
-				Style(spinStyle).
-				Title("Fetching assessments...").
-				Action(func() {
-					courses, _ = decanter.GetUserCourses()
-				}).Run()
-
-			if !all {
-				courses = filter(courses, func(c Autolab.CoursesResponse) bool {
-					return c.Semester == "s25"
-				})
+			var rows []courseAssessment
+			withSpinner("Fetching assessments...", func() {
+				var courses []Autolab.CoursesResponse
+				courses, err = decanter.GetUserCourses()
+				if err != nil {
+					return
+				}
+				if !all {
+					_, courses = decanter.coursesIn(semester, courses)
+				}
+				rows = decanter.fetchAssessments(courses)
+			})
+			if err != nil {
+				printError("Something went wrong while fetching courses.\n" + err.Error())
+				return
 			}
 
-			// Technically this is a lie.
-			fmt.Println(finished("Fetched assessments"))
-			displayAssessmentList(decanter, courses)
+			status("Fetched assessments")
+			show(assessmentList(rows), func() { displayAssessmentList(rows) })
 		case "submissions", "subs":
 			if course == "" || assessment == "" {
-				fmt.Println(errorMsg("To view submissions, please pass a course and assessment."))
+				printError("To view submissions, please pass a course and assessment.")
 				return
 			}
 			var submissions []Autolab.SubmissionsResponse
-			spinner.New().
-				Style(spinStyle).
-				Title("Fetching submissions...").
-				Action(func() {
-					submissions, err = decanter.GetSubmissions(course, assessment)
-				}).Run()
+			var maxScores map[string]float64
+			withSpinner("Fetching submissions...", func() {
+				submissions, err = decanter.GetSubmissions(course, assessment)
+				if err == nil {
+					maxScores = decanter.maxScores(course, assessment)
+				}
+			})
 			if err != nil {
 				errStr := fmt.Sprintf("Something went wrong while fetching submissions. \nCheck your arguments:\nCourse: %s\nAssessment: %s", course, assessment)
-				fmt.Println(errorMsg(errStr))
+				printError(errStr)
 				return
 			}
 			doneStr := fmt.Sprintf("Fetched submisions for %s", course)
-			fmt.Println(finished(doneStr))
+			status(doneStr)
 
-			// Grab latest
-			var submission Autolab.SubmissionsResponse
-			for _, sub := range submissions {
-				if sub.Version > submission.Version {
-					submission = sub
+			history := newSubmissionHistory(submissions).withMax(maxScores)
+			if versionStr != "" {
+				v, err := strconv.Atoi(versionStr)
+				if err != nil {
+					printError("--version expects a number.")
+					return
 				}
+				sub, ok := history.version(v)
+				if !ok {
+					printError(fmt.Sprintf("No version %d found for %s.", v, assessment))
+					return
+				}
+				title := fmt.Sprintf("Submission (Version %d)", v)
+				show(sub, func() { displaySubmission(title, sub) })
+				return
 			}
 
-			displaySubmission(submission)
+			if err := history.sortBy(sortBy); err != nil {
+				printError(err.Error())
+				return
+			}
+			var limit int
+			if limitStr != "" {
+				limit, err = strconv.Atoi(limitStr)
+				if err != nil {
+					printError("--limit expects a number.")
+					return
+				}
+			}
+			history = history.limit(limit)
+			show(history, func() { displaySubmissionHistory(history) })
 		case "me":
 			var user Autolab.UserResponse
-			spinner.New().
-				Style(spinStyle).
-				Title("Fetching user data...").
-				Action(func() {
-					user, _ = decanter.GetUserInfo()
-				}).Run()
-			fmt.Println(finished("Fetched user data"))
-			displayUserInfo(user)
+			withSpinner("Fetching user data...", func() {
+				user, err = decanter.GetUserInfo()
+			})
+			if err != nil {
+				printError("Something went wrong while fetching user data.\n" + err.Error())
+				return
+			}
+			status("Fetched user data")
+			show(userInfo(user), func() { displayUserInfo(user) })
 		default:
-			fmt.Println("Invalid list group.\nOptions: courses|assessments")
+			printError("Invalid list group.\nOptions: courses|assessments|submissions|me")
+		}
+	default:
+		printError("Command not recognized.")
+	}
+}
+
+// `telemetry` doesn't need a token (or the Autolab client).
+func runTelemetryCommand(args []string, limitStr string) {
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "status":
+		s := newTelemetryStatus(loadTelemetrySettings())
+		show(s, func() { displayTelemetryStatus(s) })
+	case "enable", "disable":
+		if err := setTelemetryEnabled(action == "enable"); err != nil {
+			printError("Could not save telemetry settings.\n" + err.Error())
+			return
+		}
+		if action == "disable" {
+			// Don't send anything still waiting from earlier runs.
+			newTelemetrySpool().Take()
+		}
+		status(fmt.Sprintf("Telemetry %sd", action))
+	case "show":
+		limit := 20
+		if limitStr != "" {
+			var err error
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil {
+				printError("--limit expects a number.")
+				return
+			}
+		}
+		records, err := newTelemetryLog().Tail(limit)
+		if err != nil {
+			printError("Could not read the telemetry log.\n" + err.Error())
+			return
 		}
+		show(telemetryRecords(records), func() { displayTelemetryRecords(records) })
 	default:
-		fmt.Println("Command not recognized.")
+		printError("Expected one of: status|enable|disable|show")
 	}
 }
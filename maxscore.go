@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+// Students are forbidden from the problems endpoint, so once a course
+// says no we don't ask again for a while (roles rarely change mid-term).
+const problemsDeniedTTL = 30 * 24 * time.Hour
+
+// Max score per problem for an assessment.
+// We ask Autolab first, which only works if the token has instructor
+// scopes, and fall back to the config. Returns nil if neither knows.
+func (d Decanter) maxScores(course, assessment string) map[string]float64 {
+	denied := loadProblemsDenied()
+	if t, ok := denied[course]; !ok || time.Since(t) > problemsDeniedTTL {
+		if scores, err := d.problemMaxScores(course, assessment); err == nil && len(scores) > 0 {
+			return scores
+		} else if refused(err) {
+			denied[course] = time.Now()
+			saveProblemsDenied(denied)
+		}
+	}
+
+	if byAssessment, ok := d.conf.MaxScores[course]; ok {
+		return byAssessment[assessment]
+	}
+	return nil
+}
+
+func (d Decanter) problemMaxScores(course, assessment string) (map[string]float64, error) {
+	problems, err := d.GetProblems(course, assessment)
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]float64, len(problems))
+	for _, p := range problems {
+		// Optional problems are extra credit; they don't count towards the total.
+		if !p.Optional {
+			scores[p.Name] = p.MaxScore
+		}
+	}
+	return scores, nil
+}
+
+// Whether asking again would get the same answer. Some installs send
+// students a 404 rather than a 403, so any client error counts; server
+// errors are more likely to be passing, so they aren't remembered.
+func refused(err error) bool {
+	var statusErr *Autolab.StatusError
+	return errors.As(err, &statusErr) && !statusErr.Temporary() &&
+		statusErr.Code >= 400 && statusErr.Code < 500 && statusErr.Code != http.StatusRequestTimeout
+}
+
+// Courses whose problems we were refused, and when.
+// Kept in ~/.decanter/problems-denied.json.
+func problemsDeniedFile() string {
+	return path.Join(decanterDir(), "problems-denied.json")
+}
+
+func loadProblemsDenied() map[string]time.Time {
+	denied := map[string]time.Time{}
+	if b, err := os.ReadFile(problemsDeniedFile()); err == nil {
+		json.Unmarshal(b, &denied)
+	}
+	return denied
+}
+
+// Losing an entry to a concurrent write only costs a request, so no lock.
+func saveProblemsDenied(denied map[string]time.Time) {
+	b, err := json.MarshalIndent(denied, "", "  ")
+	if err != nil {
+		return
+	}
+	os.MkdirAll(decanterDir(), 0755)
+	tmp := problemsDeniedFile() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		lg.Println("Error saving problems cache:", err)
+		return
+	}
+	os.Rename(tmp, problemsDeniedFile())
+}
+
+func maxTotal(maxScores map[string]float64) *float64 {
+	if len(maxScores) == 0 {
+		return nil
+	}
+	var total float64
+	for _, v := range maxScores {
+		total += v
+	}
+	return &total
+}
+
+// "score" or "score / max"
+func displayTotal(total float64, maxTotal *float64) string {
+	s := Autolab.ReleasedScore(total).String()
+	if maxTotal != nil {
+		s += " / " + Autolab.ReleasedScore(*maxTotal).String()
+	}
+	return s
+}
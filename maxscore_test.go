@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+func TestRefused(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"forbidden", &Autolab.StatusError{Code: http.StatusForbidden}, true},
+		{"unauthorized", &Autolab.StatusError{Code: http.StatusUnauthorized}, true},
+		{"not found", &Autolab.StatusError{Code: http.StatusNotFound}, true},
+		{"wrapped", fmt.Errorf("problems: %w", &Autolab.StatusError{Code: http.StatusNotFound}), true},
+		{"rate limited", &Autolab.StatusError{Code: http.StatusTooManyRequests}, false},
+		{"timed out", &Autolab.StatusError{Code: http.StatusRequestTimeout}, false},
+		{"server error", &Autolab.StatusError{Code: http.StatusInternalServerError}, false},
+		{"unavailable", &Autolab.StatusError{Code: http.StatusServiceUnavailable}, false},
+		{"network", errors.New("connection reset by peer"), false},
+		{"no error", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refused(tt.err); got != tt.want {
+				t.Errorf("refused(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProblemsDeniedRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if denied := loadProblemsDenied(); len(denied) != 0 {
+		t.Fatalf("fresh cache = %v, want empty", denied)
+	}
+
+	saveProblemsDenied(map[string]time.Time{"cse220-s24": time.Now()})
+	denied := loadProblemsDenied()
+	if _, ok := denied["cse220-s24"]; !ok || len(denied) != 1 {
+		t.Errorf("loaded %v, want cse220-s24 only", denied)
+	}
+}
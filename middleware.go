@@ -0,0 +1,160 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+)
+
+// A Layer wraps a RoundTripper to add behaviour (logging, retries, telemetry...).
+// Layers are plain functions so they compose with anything
+// written against net/http.
+type Layer func(http.RoundTripper) http.RoundTripper
+
+// Lets a plain function act as a RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Wrap base in layers. The first layer sees the request first
+// and the response last, i.e. Chain(t, a, b) == a(b(t)).
+func Chain(base http.RoundTripper, layers ...Layer) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	rt := base
+	for i := len(layers) - 1; i >= 0; i-- {
+		rt = layers[i](rt)
+	}
+	return rt
+}
+
+// Runs before a request is sent. The request is a clone, so it's safe
+// to modify. Returning a response or an error skips the rest of the chain.
+type RequestHook func(*http.Request) (*http.Response, error)
+
+// Runs once a response (or error) comes back, and may replace either.
+type ResponseHook func(*http.Request, *http.Response, error) (*http.Response, error)
+
+func OnRequest(hook RequestHook) Layer {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			// RoundTrippers must not modify the caller's request.
+			req = req.Clone(req.Context())
+			resp, err := hook(req)
+			if resp != nil || err != nil {
+				return resp, err
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func OnResponse(hook ResponseHook) Layer {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			return hook(req, resp, err)
+		})
+	}
+}
+
+// What observers get to see of a request. These are copies,
+// and never include bodies, so observers can't race with the transport.
+type RequestInfo struct {
+	Method        string
+	URL           neturl.URL
+	Header        http.Header
+	ContentLength int64
+	Start         time.Time
+}
+
+type ResponseInfo struct {
+	StatusCode    int
+	Header        http.Header
+	ContentLength int64
+	Duration      time.Duration
+	Err           error
+}
+
+func newRequestInfo(req *http.Request) RequestInfo {
+	return RequestInfo{
+		Method:        req.Method,
+		URL:           *req.URL,
+		Header:        req.Header.Clone(),
+		ContentLength: req.ContentLength,
+		Start:         time.Now(),
+	}
+}
+
+func newResponseInfo(start time.Time, resp *http.Response, err error) ResponseInfo {
+	info := ResponseInfo{Duration: time.Since(start), Err: err}
+	if resp != nil {
+		info.StatusCode = resp.StatusCode
+		info.Header = resp.Header.Clone()
+		info.ContentLength = resp.ContentLength
+	}
+	return info
+}
+
+// Observers watch traffic without slowing it down:
+// callbacks run in the background and can't modify anything.
+// Call Wait before exiting to let them finish.
+type Observers struct {
+	wg sync.WaitGroup
+}
+
+// Called with every request and its outcome.
+func (o *Observers) Observe(f func(RequestInfo, ResponseInfo)) Layer {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			reqInfo := newRequestInfo(req)
+			resp, err := next.RoundTrip(req)
+			respInfo := newResponseInfo(reqInfo.Start, resp, err)
+
+			o.wg.Add(1)
+			go func() {
+				defer o.wg.Done()
+				f(reqInfo, respInfo)
+			}()
+			return resp, err
+		})
+	}
+}
+
+// Wait for running observers, up to timeout.
+// Returns false if some were still running.
+func (o *Observers) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		o.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Log every request with its status and duration.
+func Logging(logger *log.Logger) Layer {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			elapsed := time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				logger.Printf("%s %s: %v (%s)", req.Method, req.URL.Path, err, elapsed)
+			} else {
+				logger.Printf("%s %s: %s (%s)", req.Method, req.URL.Path, resp.Status, elapsed)
+			}
+			return resp, err
+		})
+	}
+}
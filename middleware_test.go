@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A transport that answers every request with 200 and the request body.
+func echoTransport() RoundTripperFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		var body []byte
+		if req.Body != nil {
+			body, _ = io.ReadAll(req.Body)
+		}
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			Body:          io.NopCloser(strings.NewReader(string(body))),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+}
+
+// Records its name on the way in and out.
+func traceLayer(name string, mu *sync.Mutex, calls *[]string) Layer {
+	record := func(s string) {
+		mu.Lock()
+		*calls = append(*calls, s)
+		mu.Unlock()
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			record(name + " req")
+			resp, err := next.RoundTrip(req)
+			record(name + " resp")
+			return resp, err
+		})
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers []string
+		want   []string
+	}{
+		{"none", nil, nil},
+		{"one", []string{"a"}, []string{"a req", "a resp"}},
+		{"first sees the request first", []string{"a", "b", "c"},
+			[]string{"a req", "b req", "c req", "c resp", "b resp", "a resp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var calls []string
+			var layers []Layer
+			for _, name := range tt.layers {
+				layers = append(layers, traceLayer(name, &mu, &calls))
+			}
+			req, _ := http.NewRequest(http.MethodGet, "http://autolab.test/api/v1/user", nil)
+			if _, err := Chain(echoTransport(), layers...).RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("calls = %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestHooks(t *testing.T) {
+	canned := &http.Response{StatusCode: http.StatusTeapot, Body: http.NoBody}
+	errHook := errors.New("hook failed")
+
+	tests := []struct {
+		name       string
+		layer      Layer
+		wantStatus int
+		wantErr    error
+		wantSent   bool
+	}{
+		{
+			name:       "request hook passes through",
+			layer:      OnRequest(func(*http.Request) (*http.Response, error) { return nil, nil }),
+			wantStatus: http.StatusOK,
+			wantSent:   true,
+		},
+		{
+			name:       "request hook short-circuits with a response",
+			layer:      OnRequest(func(*http.Request) (*http.Response, error) { return canned, nil }),
+			wantStatus: http.StatusTeapot,
+		},
+		{
+			name:    "request hook short-circuits with an error",
+			layer:   OnRequest(func(*http.Request) (*http.Response, error) { return nil, errHook }),
+			wantErr: errHook,
+		},
+		{
+			name: "response hook replaces the response",
+			layer: OnResponse(func(*http.Request, *http.Response, error) (*http.Response, error) {
+				return canned, nil
+			}),
+			wantStatus: http.StatusTeapot,
+			wantSent:   true,
+		},
+		{
+			name: "response hook replaces the error",
+			layer: OnResponse(func(*http.Request, *http.Response, error) (*http.Response, error) {
+				return nil, errHook
+			}),
+			wantErr:  errHook,
+			wantSent: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := false
+			base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				sent = true
+				return echoTransport()(req)
+			})
+			req, _ := http.NewRequest(http.MethodGet, "http://autolab.test/", nil)
+			resp, err := Chain(base, tt.layer).RoundTrip(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if sent != tt.wantSent {
+				t.Errorf("sent = %v, want %v", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestOnRequestDoesNotModifyCallersRequest(t *testing.T) {
+	layer := OnRequest(func(req *http.Request) (*http.Response, error) {
+		req.Header.Set("X-Added", "yes")
+		return nil, nil
+	})
+	var seen string
+	base := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		seen = req.Header.Get("X-Added")
+		return echoTransport()(req)
+	})
+	req, _ := http.NewRequest(http.MethodGet, "http://autolab.test/", nil)
+	if _, err := Chain(base, layer).RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if seen != "yes" {
+		t.Errorf("transport saw X-Added = %q, want yes", seen)
+	}
+	if got := req.Header.Get("X-Added"); got != "" {
+		t.Errorf("caller's request was modified: X-Added = %q", got)
+	}
+}
+
+// What a hook that needs the body would do: read it without consuming it.
+// Afterwards req.Body (and req.GetBody) replay the same bytes.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+
+	b, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	return b, nil
+}
+
+// Read the response body without consuming it.
+func responseBody(resp *http.Response) ([]byte, error) {
+	if resp == nil || resp.Body == nil {
+		return nil, nil
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	return b, err
+}
+
+func TestBodies(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   io.Reader
+		length int64
+	}{
+		{"no body", nil, 0},
+		{"replayable body", strings.NewReader("file=handin.tar"), 15},
+		// Not one of the types NewRequest knows how to replay.
+		{"one-shot body", io.MultiReader(strings.NewReader("file="), strings.NewReader("handin.tar")), 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var observed RequestInfo
+			var observers Observers
+			peek := OnRequest(func(req *http.Request) (*http.Response, error) {
+				b, err := requestBody(req)
+				if err != nil {
+					return nil, err
+				}
+				if int64(len(b)) != tt.length {
+					t.Errorf("hook read %d bytes, want %d", len(b), tt.length)
+				}
+				return nil, nil
+			})
+			readResp := OnResponse(func(_ *http.Request, resp *http.Response, err error) (*http.Response, error) {
+				if _, readErr := responseBody(resp); readErr != nil {
+					return nil, readErr
+				}
+				return resp, err
+			})
+			observe := observers.Observe(func(req RequestInfo, _ ResponseInfo) { observed = req })
+
+			req, _ := http.NewRequest(http.MethodPost, "http://autolab.test/", tt.body)
+			if tt.body != nil {
+				req.ContentLength = tt.length
+			}
+			resp, err := Chain(echoTransport(), observe, peek, readResp).RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The hooks peeked at both bodies; the caller and transport still get all of them.
+			echoed, _ := io.ReadAll(resp.Body)
+			if int64(len(echoed)) != tt.length {
+				t.Errorf("transport got %d bytes, want %d", len(echoed), tt.length)
+			}
+			if resp.ContentLength != tt.length {
+				t.Errorf("response ContentLength = %d, want %d", resp.ContentLength, tt.length)
+			}
+			if !observers.Wait(time.Second) {
+				t.Fatal("observer didn't finish")
+			}
+			if observed.ContentLength != tt.length {
+				t.Errorf("observed ContentLength = %d, want %d", observed.ContentLength, tt.length)
+			}
+		})
+	}
+}
+
+func TestObserversWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		takes    time.Duration
+		timeout  time.Duration
+		finished bool
+	}{
+		{"finishes in time", 0, time.Second, true},
+		{"times out", time.Second, 20 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var observers Observers
+			observe := observers.Observe(func(RequestInfo, ResponseInfo) { time.Sleep(tt.takes) })
+
+			start := time.Now()
+			req, _ := http.NewRequest(http.MethodGet, "http://autolab.test/", nil)
+			if _, err := Chain(echoTransport(), observe).RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+			// Observers run in the background, so they never hold up the request.
+			if elapsed := time.Since(start); elapsed >= tt.takes && tt.takes > 0 {
+				t.Errorf("request took %s, observer should run in the background", elapsed)
+			}
+			if got := observers.Wait(tt.timeout); got != tt.finished {
+				t.Errorf("Wait = %v, want %v", got, tt.finished)
+			}
+		})
+	}
+}
+
+func TestObserverSeesErrors(t *testing.T) {
+	var observers Observers
+	var got ResponseInfo
+	observe := observers.Observe(func(_ RequestInfo, resp ResponseInfo) { got = resp })
+	failing := RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://autolab.test/", nil)
+	if _, err := Chain(failing, observe).RoundTrip(req); err == nil {
+		t.Fatal("expected an error")
+	}
+	observers.Wait(time.Second)
+	if got.Err == nil || got.StatusCode != 0 {
+		t.Errorf("observer got %+v, want the error and no status", got)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/term"
+)
+
+// How to let the user know grading finished.
+// Any combination of these can be set in the config, i.e.
+//
+//	[notify]
+//	methods = ["bell", "osc9", "desktop"]
+//	command = "~/bin/on-graded.sh"
+//
+// The command is run through the shell, with the result JSON on stdin.
+const (
+	notifyBell    = "bell"
+	notifyOSC9    = "osc9"   // iTerm2, Windows Terminal, WezTerm...
+	notifyOSC777  = "osc777" // rxvt-unicode, foot, Ghostty...
+	notifyDesktop = "desktop"
+)
+
+type NotifyConfig struct {
+	Methods []string `toml:"methods"`
+	Command string   `toml:"command"`
+}
+
+var defaultNotifyMethods = []string{notifyBell, notifyDesktop}
+
+func (d Decanter) notify(result submitOutput) {
+	title := fmt.Sprintf("%s graded", result.Assessment)
+	body := fmt.Sprintf("Version %d", result.Version)
+	if result.Graded != nil {
+		body += ": " + displayTotal(result.Graded.Total, result.Graded.Max)
+	}
+	if result.Diff != nil {
+		body += fmt.Sprintf(" (%+.2f)", result.Diff.Net)
+	}
+
+	for _, method := range d.conf.Notify.Methods {
+		var err error
+		switch method {
+		case notifyBell:
+			err = writeTerminal("\a")
+		case notifyOSC9:
+			err = writeTerminal(fmt.Sprintf("\x1b]9;%s: %s\x07", title, body))
+		case notifyOSC777:
+			err = writeTerminal(fmt.Sprintf("\x1b]777;notify;%s;%s\x07", title, body))
+		case notifyDesktop:
+			err = desktopNotification(title, body)
+		default:
+			err = fmt.Errorf("unknown method %q", method)
+		}
+		if err != nil {
+			printError("Could not send notification.\n" + err.Error())
+		}
+	}
+
+	if d.conf.Notify.Command != "" {
+		if err := runNotifyCommand(d.conf.Notify.Command, result); err != nil {
+			printError("Notification command failed.\n" + err.Error())
+		}
+	}
+}
+
+// Escape sequences go to whichever of stderr/stdout is a terminal,
+// so they never end up in piped output.
+func writeTerminal(seq string) error {
+	for _, f := range []*os.File{os.Stderr, os.Stdout} {
+		if term.IsTerminal(int(f.Fd())) {
+			_, err := f.WriteString(seq)
+			return err
+		}
+	}
+	return nil
+}
+
+// Best effort; if there's nothing to notify with we stay quiet.
+func desktopNotification(title, body string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", body, title)
+		return exec.Command("osascript", "-e", script).Run()
+	default:
+		if _, err := exec.LookPath("notify-send"); err != nil {
+			return nil
+		}
+		return exec.Command("notify-send", "--app-name=decanter", title, body).Run()
+	}
+}
+
+func runNotifyCommand(command string, result submitOutput) error {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/huh/spinner"
+	"github.com/p5quared/decanter/Autolab"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+type outputFormat string
+
+const (
+	outputTable outputFormat = "table"
+	outputJSON  outputFormat = "json"
+	outputYAML  outputFormat = "yaml"
+	outputCSV   outputFormat = "csv"
+)
+
+// Set from --output in main.
+var output = outputTable
+
+// Spinners are skipped when stdout isn't a terminal so output can be piped.
+// (lipgloss already drops colors on its own in that case.)
+var isTTY = term.IsTerminal(int(os.Stdout.Fd()))
+
+func parseOutputFormat(s string) (outputFormat, error) {
+	switch f := outputFormat(s); f {
+	case outputTable, outputJSON, outputYAML, outputCSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (options: json|yaml|csv|table)", s)
+}
+
+func structuredOutput() bool {
+	return output != outputTable
+}
+
+// Run action behind a spinner, or just run it when nobody's watching.
+func withSpinner(title string, action func()) {
+	if structuredOutput() || !isTTY {
+		action()
+		return
+	}
+	spinner.New().
+		Style(spinStyle).
+		Title(title).
+		Action(action).
+		Run()
+}
+
+// Progress messages are only for humans.
+func status(s string) {
+	if !structuredOutput() {
+		fmt.Println(finished(s))
+	}
+}
+
+func printError(s string) {
+	fmt.Fprintln(os.Stderr, errorMsg(s))
+}
+
+func printWarning(s string) {
+	fmt.Fprintln(os.Stderr, warningMsg(s))
+}
+
+// Show v in the requested format;
+// table output is left to the display function.
+func show(v any, display func()) {
+	if !structuredOutput() {
+		display()
+		return
+	}
+	if err := emit(v); err != nil {
+		printError("Could not write output.\n" + err.Error())
+	}
+}
+
+// Anything that can be written as CSV.
+type tabular interface {
+	csvHeader() []string
+	csvRows() [][]string
+}
+
+func emit(v any) error {
+	switch output {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		return emitYAML(v)
+	case outputCSV:
+		t, ok := v.(tabular)
+		if !ok {
+			return fmt.Errorf("csv output is not supported here")
+		}
+		w := csv.NewWriter(os.Stdout)
+		w.Write(t.csvHeader())
+		w.WriteAll(t.csvRows())
+		return w.Error()
+	}
+	return fmt.Errorf("unknown output format %q", output)
+}
+
+// The Autolab structs only carry json tags, so we go through JSON
+// to keep field names (and order) the same in both formats.
+func emitYAML(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(b, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(&node)
+}
+
+// JSON parses as flow style YAML; reset it so we get the usual block style.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+type courseList []Autolab.CoursesResponse
+
+func (c courseList) csvHeader() []string {
+	return []string{"name", "display_name", "semester", "late_slack", "grace_days", "auth_level"}
+}
+
+func (c courseList) csvRows() [][]string {
+	var rows [][]string
+	for _, course := range c {
+		rows = append(rows, []string{
+			course.Name,
+			course.DisplayName,
+			course.Semester,
+			strconv.Itoa(course.LateSlack),
+			strconv.Itoa(course.GraceDays),
+			course.AuthLevel,
+		})
+	}
+	return rows
+}
+
+type assessmentList []courseAssessment
+
+func (a assessmentList) csvHeader() []string {
+	return []string{"course", "name", "display_name", "start_at", "due_at", "end_at", "category_name", "error"}
+}
+
+func (a assessmentList) csvRows() [][]string {
+	var rows [][]string
+	for _, row := range a {
+		var errStr string
+		if row.Err != nil {
+			errStr = row.Err.Error()
+		}
+		ass := row.Assessment
+		rows = append(rows, []string{row.Course, ass.Name, ass.DisplayName, ass.Assigned, ass.Due, ass.Closed, ass.Category, errStr})
+	}
+	return rows
+}
+
+func (c courseAssessment) MarshalJSON() ([]byte, error) {
+	type row struct {
+		Course string `json:"course"`
+		*Autolab.AssessmentsResponse
+		Error string `json:"error,omitempty"`
+	}
+	r := row{Course: c.Course}
+	// Empty if the whole course failed.
+	if c.Assessment.Name != "" {
+		r.AssessmentsResponse = &c.Assessment
+	}
+	if c.Err != nil {
+		r.Error = c.Err.Error()
+	}
+	return json.Marshal(r)
+}
+
+type userInfo Autolab.UserResponse
+
+func (u userInfo) csvHeader() []string {
+	return []string{"first_name", "last_name", "email", "school", "major", "year"}
+}
+
+func (u userInfo) csvRows() [][]string {
+	return [][]string{{u.FirstName, u.LastName, u.Email, u.School, u.Major, u.Year}}
+}
+
+// A submission along with the fields we compute for it.
+type submissionOutput struct {
+	Autolab.SubmissionsResponse
+	Total float64 `json:"total"`
+	// Only known with instructor scopes or a configured max score.
+	Max  *float64 `json:"max,omitempty"`
+	Best bool     `json:"best,omitempty"`
+}
+
+func newSubmissionOutput(sub Autolab.SubmissionsResponse) submissionOutput {
+	return submissionOutput{SubmissionsResponse: sub, Total: sub.Scores.Total()}
+}
+
+func (s submissionOutput) withMax(maxScores map[string]float64) submissionOutput {
+	s.Max = maxTotal(maxScores)
+	return s
+}
+
+func (s submissionOutput) problems() []string {
+	var problems []string
+	for k := range s.Scores {
+		problems = append(problems, k)
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func (s submissionOutput) csvHeader() []string {
+	return append([]string{"version", "filename", "created_at", "total", "max"}, s.problems()...)
+}
+
+func (s submissionOutput) csvRows() [][]string {
+	row := []string{strconv.Itoa(s.Version), s.Filename, s.Submitted, formatFloat(s.Total), formatMax(s.Max)}
+	for _, p := range s.problems() {
+		row = append(row, formatScore(s.Scores[p]))
+	}
+	return [][]string{row}
+}
+
+// Result of `submit`, and of `submit --wait` or `watch` once graded.
+type submitOutput struct {
+	Course     string `json:"course"`
+	Assessment string `json:"assessment"`
+	File       string `json:"file,omitempty"`
+	Autolab.SubmitResponse
+	// An earlier, interrupted upload turned out to have worked.
+	Recovered bool              `json:"recovered,omitempty"`
+	Graded    *submissionOutput `json:"graded,omitempty"`
+	Diff      *scoreDiff        `json:"diff,omitempty"`
+}
+
+func (s submitOutput) csvHeader() []string {
+	h := []string{"course", "assessment", "file", "version", "filename"}
+	if s.Graded != nil {
+		h = append(h, "total", "max")
+		h = append(h, s.Graded.problems()...)
+	}
+	return h
+}
+
+func (s submitOutput) csvRows() [][]string {
+	row := []string{s.Course, s.Assessment, s.File, strconv.Itoa(s.Version), s.Filename}
+	if s.Graded != nil {
+		row = append(row, formatFloat(s.Graded.Total), formatMax(s.Graded.Max))
+		for _, p := range s.Graded.problems() {
+			row = append(row, formatScore(s.Graded.Scores[p]))
+		}
+	}
+	return [][]string{row}
+}
+
+type queueList []queuedSubmission
+
+func (q queueList) csvHeader() []string {
+	return []string{"course", "assessment", "version", "file", "state", "submitted_at", "updated_at", "total", "max", "error"}
+}
+
+func (q queueList) csvRows() [][]string {
+	var rows [][]string
+	for _, e := range q {
+		var total, maxTotal string
+		if e.Result != nil && e.Result.Graded != nil {
+			total, maxTotal = formatFloat(e.Result.Graded.Total), formatMax(e.Result.Graded.Max)
+		}
+		rows = append(rows, []string{
+			e.Course,
+			e.Assessment,
+			strconv.Itoa(e.Version),
+			e.File,
+			e.State,
+			e.SubmittedAt.Format(time.RFC3339),
+			e.UpdatedAt.Format(time.RFC3339),
+			total,
+			maxTotal,
+			e.Error,
+		})
+	}
+	return rows
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatMax(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return formatFloat(*f)
+}
+
+// Unlike Score.String, leaves missing scores empty and doesn't round.
+func formatScore(s Autolab.Score) string {
+	switch s.State {
+	case Autolab.ScoreReleased:
+		return formatFloat(s.Value)
+	case Autolab.ScoreUnreleased:
+		return s.String()
+	default:
+		return ""
+	}
+}
+
+// `telemetry status`
+type telemetryStatus struct {
+	Enabled bool `json:"enabled"`
+	// False if the user was never asked (telemetry stays off).
+	Asked     bool       `json:"asked"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	Log       string     `json:"log"`
+	// Waiting to be sent on the next run, and given up on.
+	Queued  int `json:"queued"`
+	Dropped int `json:"dropped"`
+}
+
+func newTelemetryStatus(settings telemetrySettings) telemetryStatus {
+	s := telemetryStatus{
+		Enabled: settings.Enabled,
+		Asked:   !settings.DecidedAt.IsZero(),
+		Log:     newTelemetryLog().file,
+	}
+	// Not worth failing status over.
+	spooled, _ := newTelemetrySpool().Load()
+	s.Queued, s.Dropped = len(spooled.Events), spooled.Dropped
+	if s.Asked {
+		s.DecidedAt = &settings.DecidedAt
+	}
+	return s
+}
+
+func (s telemetryStatus) csvHeader() []string {
+	return []string{"enabled", "asked", "decided_at", "log", "queued", "dropped"}
+}
+
+func (s telemetryStatus) csvRows() [][]string {
+	var decided string
+	if s.DecidedAt != nil {
+		decided = s.DecidedAt.Format(time.RFC3339)
+	}
+	return [][]string{{strconv.FormatBool(s.Enabled), strconv.FormatBool(s.Asked), decided, s.Log, strconv.Itoa(s.Queued), strconv.Itoa(s.Dropped)}}
+}
+
+// `telemetry show`
+type telemetryRecords []telemetryRecord
+
+func (t telemetryRecords) csvHeader() []string {
+	return []string{"time", "kind", "event"}
+}
+
+func (t telemetryRecords) csvRows() [][]string {
+	rows := make([][]string, 0, len(t))
+	for _, r := range t {
+		rows = append(rows, []string{r.Time.Format(time.RFC3339), r.Kind, string(r.Event)})
+	}
+	return rows
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+// Submissions registered with `submit --detach`,
+// which the daemon watches until they're graded.
+type queuedSubmission struct {
+	Course      string    `json:"course"`
+	Assessment  string    `json:"assessment"`
+	Version     int       `json:"version"`
+	File        string    `json:"file"`
+	Notify      bool      `json:"notify"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// One of Autolab.WatchState, or failed
+	State  string        `json:"state"`
+	Error  string        `json:"error,omitempty"`
+	Result *submitOutput `json:"result,omitempty"`
+}
+
+const (
+	queueStateFailed = "failed"
+	// Finished entries are dropped from the queue after this long.
+	queueRetention = 7 * 24 * time.Hour
+)
+
+func (q queuedSubmission) done() bool {
+	return q.State == Autolab.WatchGraded.String() || q.State == queueStateFailed
+}
+
+func (q queuedSubmission) key() string {
+	return fmt.Sprintf("%s/%s/%d", q.Course, q.Assessment, q.Version)
+}
+
+// The queue is a JSON file in ~/.decanter shared between
+// the CLI and the daemon, so every change goes through update.
+type submissionQueue struct {
+	file string
+	lock string
+}
+
+func newSubmissionQueue() submissionQueue {
+	dir := decanterDir()
+	os.MkdirAll(dir, 0755)
+	return submissionQueue{
+		file: path.Join(dir, "queue.json"),
+		lock: path.Join(dir, "queue.lock"),
+	}
+}
+
+func (q submissionQueue) Load() ([]queuedSubmission, error) {
+	b, err := os.ReadFile(q.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []queuedSubmission
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Load, modify and save the queue while holding the lock.
+func (q submissionQueue) update(f func([]queuedSubmission) []queuedSubmission) error {
+	unlock, err := acquireLock(q.lock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := q.Load()
+	if err != nil {
+		return err
+	}
+	entries = f(entries)
+
+	var kept []queuedSubmission
+	for _, e := range entries {
+		if !e.done() || time.Since(e.UpdatedAt) < queueRetention {
+			kept = append(kept, e)
+		}
+	}
+
+	b, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename so readers never see half a file.
+	tmp := q.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.file)
+}
+
+func (q submissionQueue) Add(entry queuedSubmission) error {
+	return q.update(func(entries []queuedSubmission) []queuedSubmission {
+		return append(entries, entry)
+	})
+}
+
+// Run f while holding the lock, if every entry is done.
+// Reports whether f ran.
+func (q submissionQueue) whenIdle(f func()) (bool, error) {
+	unlock, err := acquireLock(q.lock)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	entries, err := q.Load()
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if !e.done() {
+			return false, nil
+		}
+	}
+	f()
+	return true, nil
+}
+
+// Apply f to the entry matching key, if it's still there.
+func (q submissionQueue) Set(key string, f func(*queuedSubmission)) error {
+	return q.update(func(entries []queuedSubmission) []queuedSubmission {
+		for i := range entries {
+			if entries[i].key() == key {
+				f(&entries[i])
+				entries[i].UpdatedAt = time.Now()
+			}
+		}
+		return entries
+	})
+}
+
+// A lock file is crude, but works the same everywhere.
+// Locks older than staleLock are assumed to be left over from a crash.
+func acquireLock(lock string) (func(), error) {
+	const staleLock = 10 * time.Second
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if info, statErr := os.Stat(lock); statErr == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked", lock)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
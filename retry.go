@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/p5quared/decanter/Autolab"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+type RetryOptions struct {
+	// Including the first attempt.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var defaultRetryOptions = RetryOptions{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    15 * time.Second,
+}
+
+// Retry idempotent requests that fail with a network error or a
+// transient status, backing off exponentially (with jitter) and
+// honouring Retry-After. Anything else (i.e. SubmitFile's POST) passes
+// straight through; the caller has to decide whether retrying is safe.
+func Retry(opts RetryOptions) Layer {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if !idempotent(req) {
+				return next.RoundTrip(req)
+			}
+
+			delay := opts.BaseDelay
+			for attempt := 1; ; attempt++ {
+				attemptReq := req
+				if attempt > 1 && req.GetBody != nil {
+					body, err := req.GetBody()
+					if err != nil {
+						return nil, err
+					}
+					attemptReq = req.Clone(req.Context())
+					attemptReq.Body = body
+				}
+
+				resp, err := next.RoundTrip(attemptReq)
+				if attempt >= opts.MaxAttempts || !shouldRetry(req, resp, err) {
+					return resp, err
+				}
+
+				wait := Autolab.Jitter(delay)
+				if after, ok := retryAfter(resp); ok {
+					if after > opts.MaxDelay {
+						// Not worth waiting for; let the caller see the response.
+						return resp, err
+					}
+					wait = after
+				}
+				if resp != nil {
+					// Drain so the connection can be reused.
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+
+				trace.SpanFromContext(req.Context()).AddEvent("retry", trace.WithAttributes(
+					attribute.Int("decanter.attempt", attempt),
+					attribute.String("decanter.wait", wait.String()),
+				))
+				select {
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				case <-time.After(wait):
+				}
+				delay = min(delay*2, opts.MaxDelay)
+			}
+		})
+	}
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		// Don't retry if the caller gave up, or if it wasn't the network
+		// (a bad certificate or a malformed response won't get better).
+		return req.Context().Err() == nil && !errors.Is(err, context.Canceled) && Autolab.IsNetworkError(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Retry-After is either a number of seconds or an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(h); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// Token bucket shared by every request through the layer, so the
+// poll loops (and fan-outs) can't hammer Autolab.
+func RateLimit(perSecond float64, burst int) Layer {
+	limiter := rate.NewLimiter(rate.Limit(perSecond), burst)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if err := limiter.Wait(req.Context()); err != nil {
+				return nil, err
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
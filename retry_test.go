@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var fastRetries = RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second}
+
+// As the client would see them.
+var (
+	errReset = &neturl.Error{Op: "Get", URL: "http://autolab.test/", Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}
+	errTLS   = &neturl.Error{Op: "Get", URL: "https://autolab.test/", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}
+	errAlert = &neturl.Error{Op: "Get", URL: "https://autolab.test/", Err: &net.OpError{Op: "remote error", Err: errors.New("tls: handshake failure")}}
+	errProto = &neturl.Error{Op: "Get", URL: "http://autolab.test/", Err: errors.New("net/http: HTTP/1.x transport connection broken: malformed HTTP response")}
+)
+
+// Answers with statuses in turn (repeating the last), counting attempts
+// and the bodies it was sent.
+type scriptedTransport struct {
+	statuses []int
+	header   http.Header
+	err      error
+	attempts int
+	bodies   []string
+}
+
+func (s *scriptedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.attempts++
+	if req.Body != nil {
+		b, _ := io.ReadAll(req.Body)
+		s.bodies = append(s.bodies, string(b))
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	status := s.statuses[min(s.attempts, len(s.statuses))-1]
+	return &http.Response{StatusCode: status, Header: s.header, Body: http.NoBody, Request: req}, nil
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		body         string
+		statuses     []int
+		header       http.Header
+		err          error
+		wantStatus   int
+		wantAttempts int
+		minWait      time.Duration
+	}{
+		{"success", http.MethodGet, "", []int{200}, nil, nil, 200, 1, 0},
+		{"recovers", http.MethodGet, "", []int{503, 502, 200}, nil, nil, 200, 3, 0},
+		{"gives up after max attempts", http.MethodGet, "", []int{503}, nil, nil, 503, 3, 0},
+		{"client errors aren't retried", http.MethodGet, "", []int{404}, nil, nil, 404, 1, 0},
+		{"network errors are retried", http.MethodGet, "", nil, nil, errReset, 0, 3, 0},
+		{"timeouts are retried", http.MethodGet, "", nil, nil, &neturl.Error{Op: "Get", URL: "http://autolab.test/", Err: os.ErrDeadlineExceeded}, 0, 3, 0},
+		{"bad certificates aren't retried", http.MethodGet, "", nil, nil, errTLS, 0, 1, 0},
+		{"refused handshakes aren't retried", http.MethodGet, "", nil, nil, errAlert, 0, 1, 0},
+		{"other errors aren't retried", http.MethodGet, "", nil, nil, errProto, 0, 1, 0},
+		{"uploads aren't retried", http.MethodPost, "handin", []int{503}, nil, nil, 503, 1, 0},
+		{"network errors on uploads aren't retried", http.MethodPost, "handin", nil, nil, errReset, 0, 1, 0},
+		{"honours Retry-After seconds", http.MethodGet, "", []int{429, 200},
+			http.Header{"Retry-After": {"1"}}, nil, 200, 2, time.Second},
+		{"honours Retry-After dates", http.MethodGet, "", []int{503, 200},
+			http.Header{"Retry-After": {time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)}}, nil, 200, 2, 0},
+		{"doesn't wait for a long Retry-After", http.MethodGet, "", []int{429, 200},
+			http.Header{"Retry-After": {"120"}}, nil, 429, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &scriptedTransport{statuses: tt.statuses, header: tt.header, err: tt.err}
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req, _ := http.NewRequest(tt.method, "http://autolab.test/", body)
+
+			start := time.Now()
+			resp, err := Chain(transport, Retry(fastRetries)).RoundTrip(req)
+			elapsed := time.Since(start)
+
+			if (err != nil) != (tt.err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil && resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if transport.attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", transport.attempts, tt.wantAttempts)
+			}
+			if elapsed < tt.minWait {
+				t.Errorf("retried after %s, want at least %s", elapsed, tt.minWait)
+			}
+		})
+	}
+}
+
+// A certificate we don't trust will be just as untrusted next time.
+func TestRetryBadCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var attempts int
+	// Not server.Client(), which trusts the test certificate.
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	if _, err := Chain(transport, Retry(fastRetries)).RoundTrip(req); err == nil {
+		t.Fatal("expected the certificate to be rejected")
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
+
+// GETs with a body can be retried as long as the body can be replayed.
+func TestRetryReplaysBody(t *testing.T) {
+	transport := &scriptedTransport{statuses: []int{503, 200}}
+	req, _ := http.NewRequest(http.MethodGet, "http://autolab.test/", strings.NewReader("query"))
+	if _, err := Chain(transport, Retry(fastRetries)).RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.bodies) != 2 || transport.bodies[0] != "query" || transport.bodies[1] != "query" {
+		t.Errorf("bodies = %q, want the same body twice", transport.bodies)
+	}
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	transport := &scriptedTransport{statuses: []int{503}}
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://autolab.test/", nil)
+
+	slow := RetryOptions{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Minute}
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err := Chain(transport, Retry(slow)).RoundTrip(req)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if transport.attempts != 1 {
+		t.Errorf("attempts = %d, want 1", transport.attempts)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	transport := &scriptedTransport{statuses: []int{200}}
+	rt := Chain(transport, RateLimit(20, 2))
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://autolab.test/", nil)
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The burst of 2 goes straight through; the other 2 wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("4 requests took %s, want at least 100ms", elapsed)
+	}
+
+	// Waiting gives up with the request's context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://autolab.test/", nil)
+	if _, err := rt.RoundTrip(req); err == nil {
+		t.Error("expected an error for a cancelled request")
+	}
+	if transport.attempts != 4 {
+		t.Errorf("attempts = %d, want 4", transport.attempts)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSalt = "0f1e2d3c4b5a69788796a5b4c3d2e1f0"
+
+// Things that identify a user or grant access, none of
+// which may ever reach a sink.
+var secrets = []string{
+	"cse220-s24",           // course
+	"pa3-linked-lists",     // assessment
+	"me@buffalo.edu",       // user, as Autolab names handins
+	"handin.tar",           // file
+	"ya29.access-token",    // ?access_token=
+	"1//refresh-token",     // ?refresh_token=
+	"device-code-8c1f",     // ?code=
+	"Bearer",               // Authorization
+	"session=cookie-value", // Cookie
+	"autolab.cse.buffalo.edu",
+	"10.0.0.7", // our address
+	testSalt,
+}
+
+// Runs req through the telemetry layer, over a transport
+// that answers with resp or fails with err.
+func trackThrough(t *testing.T, req *http.Request, resp *http.Response, err error) *MemorySink {
+	t.Helper()
+	sink := &MemorySink{}
+	var observers Observers
+	transport := RoundTripperFunc(func(*http.Request) (*http.Response, error) { return resp, err })
+
+	Chain(transport, observers.Observe(scrub(testSalt, track(sink)))).RoundTrip(req)
+	if !observers.Wait(time.Second) {
+		t.Fatal("telemetry didn't finish")
+	}
+	return sink
+}
+
+func assertNoSecrets(t *testing.T, sink *MemorySink) {
+	t.Helper()
+	b, err := json.Marshal(struct {
+		Requests []requestEvent
+		Errors   []errorEvent
+	}{sink.Requests, sink.Errors})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range secrets {
+		if strings.Contains(string(b), s) {
+			t.Errorf("%q reached the sink: %s", s, b)
+		}
+	}
+}
+
+func newTestRequest(method, url string) *http.Request {
+	req, _ := http.NewRequest(method, url, nil)
+	req.Header.Set("Authorization", "Bearer ya29.access-token")
+	req.Header.Set("Cookie", "session=cookie-value")
+	return req
+}
+
+func TestScrubbedRequests(t *testing.T) {
+	const base = "https://autolab.cse.buffalo.edu/api/v1/courses/cse220-s24/assessments/pa3-linked-lists"
+	ok := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Set-Cookie": {"session=cookie-value"}}, Body: http.NoBody}
+	notFound := &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: http.NoBody}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		resp *http.Response
+		err  error
+	}{
+		{"submissions", newTestRequest(http.MethodGet, base+"/submissions"), ok, nil},
+		{"submit", newTestRequest(http.MethodPost, base+"/submit"), ok, nil},
+		{"problems refused", newTestRequest(http.MethodGet, base+"/problems"), notFound, nil},
+		{"one submission", newTestRequest(http.MethodGet, base+"/submissions/me@buffalo.edu_3_handin.tar"), ok, nil},
+		{"token in the query", newTestRequest(http.MethodGet, base+"/submissions?access_token=ya29.access-token&refresh_token=1//refresh-token"), ok, nil},
+		{"device code", newTestRequest(http.MethodPost, "https://autolab.cse.buffalo.edu/oauth/device_flow_authorize?code=device-code-8c1f"), notFound, nil},
+		{"credentials in the url", newTestRequest(http.MethodGet, "https://me@buffalo.edu:ya29.access-token@autolab.cse.buffalo.edu/api/v1/user#pa3-linked-lists"), ok, nil},
+		{
+			name: "url error",
+			req:  newTestRequest(http.MethodGet, base+"/submissions?access_token=ya29.access-token"),
+			err: &neturl.Error{
+				Op:  "Get",
+				URL: base + "/submissions?access_token=ya29.access-token",
+				Err: errors.New("context deadline exceeded"),
+			},
+		},
+		{
+			name: "network error",
+			req:  newTestRequest(http.MethodPost, base+"/submit"),
+			err: &neturl.Error{
+				Op:  "Post",
+				URL: base + "/submit?code=device-code-8c1f",
+				Err: &net.OpError{
+					Op:     "read",
+					Net:    "tcp",
+					Source: &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 52114},
+					Addr:   &net.TCPAddr{IP: net.ParseIP("128.205.1.1"), Port: 443},
+					Err:    errors.New("connection reset by peer"),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := trackThrough(t, tt.req, tt.resp, tt.err)
+			if len(sink.Requests) != 1 {
+				t.Fatalf("got %d request events, want 1", len(sink.Requests))
+			}
+			failed := tt.err != nil || tt.resp.StatusCode != http.StatusOK
+			if failed != (len(sink.Errors) == 1) {
+				t.Errorf("got %d error events, want failed = %v", len(sink.Errors), failed)
+			}
+			assertNoSecrets(t, sink)
+		})
+	}
+}
+
+// The real transport's errors quote addresses we can't pass in ourselves.
+func TestScrubbedTransportError(t *testing.T) {
+	// A port nothing is listening on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	sink := &MemorySink{}
+	var observers Observers
+	client := &http.Client{Transport: Chain(http.DefaultTransport, observers.Observe(scrub(testSalt, track(sink))))}
+	req := newTestRequest(http.MethodGet, "http://"+addr+"/api/v1/courses/cse220-s24/assessments?access_token=ya29.access-token")
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("expected the request to fail")
+	}
+	observers.Wait(time.Second)
+
+	if len(sink.Errors) != 1 {
+		t.Fatalf("got %d error events, want 1", len(sink.Errors))
+	}
+	if e := sink.Errors[0]; strings.Contains(e.Error, addr) || strings.Contains(e.Error, "127.0.0.1") {
+		t.Errorf("address reached the sink: %q", e.Error)
+	}
+	assertNoSecrets(t, sink)
+}
+
+func TestScrubPath(t *testing.T) {
+	hashed := regexp.MustCompile(`^/api/v1/courses/[0-9a-f]{12}/assessments/[0-9a-f]{12}/submit$`)
+	p := "/api/v1/courses/cse220-s24/assessments/pa3-linked-lists/submit"
+
+	got := scrubPath(testSalt, p)
+	if !hashed.MatchString(got) {
+		t.Errorf("scrubPath(%q) = %q, want names hashed and the rest kept", p, got)
+	}
+	// The same install groups its events...
+	if again := scrubPath(testSalt, p); again != got {
+		t.Errorf("hashes aren't stable: %q then %q", got, again)
+	}
+	// ...but they can't be matched up across installs.
+	if other := scrubPath("another-salt", p); other == got {
+		t.Errorf("different salts gave the same path %q", got)
+	}
+	for _, p := range []string{"/api/v1/user", "/api/v1/courses", "/api/v1/courses/"} {
+		if got := scrubPath(testSalt, p); got != p {
+			t.Errorf("scrubPath(%q) = %q, want it unchanged", p, got)
+		}
+	}
+}
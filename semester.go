@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+// Work out the semester code (i.e. "f24") for a given date
+// from the configured term calendar.
+func semesterAt(terms []Term, t time.Time) string {
+	code := terms[len(terms)-1].Code
+	year := t.Year()
+	// Before the first term starts we're still in last year's final term.
+	if start, err := termStart(terms[0], year); err == nil && t.Before(start) {
+		year--
+	}
+	for _, term := range terms {
+		start, err := termStart(term, t.Year())
+		if err != nil {
+			continue
+		}
+		if !t.Before(start) {
+			code = term.Code
+			year = t.Year()
+		}
+	}
+	return fmt.Sprintf("%s%02d", code, year%100)
+}
+
+func termStart(term Term, year int) (time.Time, error) {
+	md, err := time.Parse("01-02", term.Start)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(year, md.Month(), md.Day(), 0, 0, 0, 0, time.Local), nil
+}
+
+// Order semesters by year, then by position in the term calendar.
+// Returns false if the semester isn't in a format we understand.
+func semesterKey(terms []Term, semester string) (int, bool) {
+	for i, term := range terms {
+		if len(semester) <= len(term.Code) || semester[:len(term.Code)] != term.Code {
+			continue
+		}
+		year, err := strconv.Atoi(semester[len(term.Code):])
+		if err != nil {
+			continue
+		}
+		return year*len(terms) + i, true
+	}
+	return 0, false
+}
+
+// Pick the semester to list by default.
+// We prefer the semester derived from today's date, but if the user
+// has no courses in it (i.e. the calendar is off, or courses haven't been
+// published yet), we use the most recent semester Autolab gave us.
+func currentSemester(terms []Term, courses []Autolab.CoursesResponse) string {
+	now := semesterAt(terms, time.Now())
+	for _, c := range courses {
+		if c.Semester == now {
+			return now
+		}
+	}
+
+	latest, latestKey := "", -1
+	for _, c := range courses {
+		key, ok := semesterKey(terms, c.Semester)
+		if ok && key > latestKey {
+			latest, latestKey = c.Semester, key
+		}
+	}
+	if latest == "" {
+		return now
+	}
+	return latest
+}
+
+// Narrow courses down to a single semester.
+// An empty semester means the current one.
+func (d Decanter) coursesIn(semester string, courses []Autolab.CoursesResponse) (string, []Autolab.CoursesResponse) {
+	if semester == "" {
+		semester = currentSemester(d.conf.Terms, courses)
+	}
+	return semester, filterCourses(courses, func(c Autolab.CoursesResponse) bool {
+		return c.Semester == semester
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 12, 0, 0, 0, time.Local)
+}
+
+func TestSemesterAt(t *testing.T) {
+	// Spring starts after Jan 1, so early January is still last fall.
+	lateSpring := []Term{{Code: "s", Start: "01-20"}, {Code: "u", Start: "05-20"}, {Code: "f", Start: "08-15"}}
+
+	tests := []struct {
+		name  string
+		terms []Term
+		at    time.Time
+		want  string
+	}{
+		{"new year's day", defaultTerms, date(2024, time.January, 1), "s24"},
+		{"spring", defaultTerms, date(2024, time.March, 3), "s24"},
+		{"day before summer", defaultTerms, date(2024, time.May, 19), "s24"},
+		{"first day of summer", defaultTerms, date(2024, time.May, 20), "u24"},
+		{"fall", defaultTerms, date(2024, time.October, 1), "f24"},
+		{"new year's eve", defaultTerms, date(2024, time.December, 31), "f24"},
+		{"before spring starts", lateSpring, date(2025, time.January, 10), "f24"},
+		{"spring starts", lateSpring, date(2025, time.January, 20), "s25"},
+		{"turn of the century", lateSpring, date(2100, time.January, 10), "f99"},
+		{"bad start dates are skipped", []Term{{Code: "s", Start: "01-01"}, {Code: "u", Start: "summer"}, {Code: "f", Start: "08-15"}},
+			date(2024, time.June, 1), "s24"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := semesterAt(tt.terms, tt.at); got != tt.want {
+				t.Errorf("semesterAt(%s) = %q, want %q", tt.at.Format("2006-01-02"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentSemester(t *testing.T) {
+	now := semesterAt(defaultTerms, time.Now())
+	courses := func(semesters ...string) []Autolab.CoursesResponse {
+		var cs []Autolab.CoursesResponse
+		for _, s := range semesters {
+			cs = append(cs, Autolab.CoursesResponse{Name: "course-" + s, Semester: s})
+		}
+		return cs
+	}
+
+	tests := []struct {
+		name    string
+		courses []Autolab.CoursesResponse
+		want    string
+	}{
+		{"has courses this semester", courses("f19", now, "s20"), now},
+		{"falls back to the latest", courses("s20", "f19", "u20", "s19"), "u20"},
+		{"later years win over later terms", courses("f19", "s20"), "s20"},
+		{"unknown semesters are ignored", courses("winter", "f19"), "f19"},
+		{"no courses", nil, now},
+		{"nothing we understand", courses("winter"), now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := currentSemester(defaultTerms, tt.courses); got != tt.want {
+				t.Errorf("currentSemester = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Fails every call with err.
+type failingSink struct{ err error }
+
+func (f failingSink) TrackRequest(requestEvent) error { return f.err }
+func (f failingSink) TrackError(errorEvent) error     { return f.err }
+func (f failingSink) Flush() error                    { return f.err }
+
+func TestNewTelemetrySink(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    TelemetryConfig
+		want    TelemetrySink
+		wantErr bool
+	}{
+		{"default is supabase", TelemetryConfig{}, &SupabaseSink{}, false},
+		{"pocketbase", TelemetryConfig{Sink: sinkPocketbase}, &PocketbaseSink{}, false},
+		{"jsonl", TelemetryConfig{Sink: sinkJSONL, URL: filepath.Join(t.TempDir(), "events.jsonl")}, &FileSink{}, false},
+		{"jsonl needs a file", TelemetryConfig{Sink: sinkJSONL}, nil, true},
+		{"none", TelemetryConfig{Sink: sinkNone}, NopSink{}, false},
+		{"unknown", TelemetryConfig{Sink: "kafka"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTelemetrySink(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.want != nil && reflect.TypeOf(got) != reflect.TypeOf(tt.want) {
+				t.Errorf("sink = %T, want %T", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileSinkRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	sink := NewFileSink(file)
+	req := requestEvent{URL: "/api/v1/courses/3f2a9c1d0b7e/assessments", Size: 0}
+	fail := errorEvent{URL: "/api/v1/user", Status: "Service Unavailable", Code: 503}
+
+	if err := sink.TrackRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.TrackError(fail); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := sink.log.Tail(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("read back %d records, want 2", len(records))
+	}
+
+	var gotReq requestEvent
+	var gotErr errorEvent
+	if records[0].Kind != telemetryKindRequest || json.Unmarshal(records[0].Event, &gotReq) != nil || gotReq != req {
+		t.Errorf("first record = %s %s, want request %+v", records[0].Kind, records[0].Event, req)
+	}
+	if records[1].Kind != telemetryKindError || json.Unmarshal(records[1].Event, &gotErr) != nil || gotErr != fail {
+		t.Errorf("second record = %s %s, want error %+v", records[1].Kind, records[1].Event, fail)
+	}
+}
+
+func TestMultiSink(t *testing.T) {
+	errDown := errors.New("sink is down")
+	errFull := errors.New("disk full")
+	first, last := &MemorySink{}, &MemorySink{}
+	sinks := multiSink{first, failingSink{errDown}, failingSink{errFull}, last}
+
+	err := sinks.TrackRequest(requestEvent{URL: "/api/v1/user"})
+	// Every failure is reported...
+	if !errors.Is(err, errDown) || !errors.Is(err, errFull) {
+		t.Errorf("TrackRequest err = %v, want both failures", err)
+	}
+	// ...and doesn't stop the other sinks getting the event.
+	for i, s := range []*MemorySink{first, last} {
+		if len(s.Requests) != 1 {
+			t.Errorf("sink %d got %d requests, want 1", i, len(s.Requests))
+		}
+	}
+
+	if err := sinks.TrackError(errorEvent{Code: 404}); !errors.Is(err, errDown) || !errors.Is(err, errFull) {
+		t.Errorf("TrackError err = %v, want both failures", err)
+	}
+	if len(last.Errors) != 1 {
+		t.Errorf("last sink got %d errors, want 1", len(last.Errors))
+	}
+	if err := sinks.Flush(); !errors.Is(err, errDown) || !errors.Is(err, errFull) {
+		t.Errorf("Flush err = %v, want both failures", err)
+	}
+
+	if err := (multiSink{first, last}).TrackRequest(requestEvent{}); err != nil {
+		t.Errorf("err = %v with no failing sinks, want nil", err)
+	}
+}
+
+func TestSupabaseSinkInsert(t *testing.T) {
+	var got []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = append(got, r)
+		bodies = append(bodies, string(b))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	sink, err := NewSupabaseSink(server.URL+"/", "anon-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.TrackBatch([]requestEvent{{URL: "/api/v1/user"}}, []errorEvent{{URL: "/api/v1/user", Code: 503}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d inserts, want 2", len(got))
+	}
+	for i, table := range []string{"requests", "errors"} {
+		r := got[i]
+		if r.Method != http.MethodPost || r.URL.Path != "/rest/v1/"+table {
+			t.Errorf("insert %d = %s %s, want POST /rest/v1/%s", i, r.Method, r.URL.Path, table)
+		}
+		if r.Header.Get("apikey") != "anon-key" || r.Header.Get("Authorization") != "Bearer anon-key" {
+			t.Errorf("insert %d isn't authenticated: %v", i, r.Header)
+		}
+		// We can't read rows back (RLS), so mustn't ask for them.
+		if r.Header.Get("Prefer") != "return=minimal" {
+			t.Errorf("insert %d Prefer = %q, want return=minimal", i, r.Header.Get("Prefer"))
+		}
+		if !strings.HasPrefix(bodies[i], "[") {
+			t.Errorf("insert %d body = %s, want a batch", i, bodies[i])
+		}
+	}
+
+	if _, err := NewSupabaseSink("", "anon-key"); err == nil {
+		t.Error("expected an error without a url")
+	}
+}
+
+// A server that never answers mustn't hold up exit.
+func TestRemoteSinksTimeOut(t *testing.T) {
+	hung := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-hung }))
+	defer server.Close()
+	defer close(hung)
+
+	supabase, _ := NewSupabaseSink(server.URL, "anon-key")
+	pocketbase := NewPocketbaseSink(server.URL)
+	tests := []struct {
+		name   string
+		sink   TelemetrySink
+		client *http.Client
+	}{
+		{"supabase", supabase, supabase.client},
+		{"pocketbase", pocketbase, pocketbase.client},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.client.Timeout <= 0 || tt.client.Timeout >= 5*time.Second {
+				t.Errorf("timeout = %s, want a few seconds, under the 5s flushTelemetry waits", tt.client.Timeout)
+			}
+			tt.client.Timeout = 50 * time.Millisecond
+			start := time.Now()
+			if err := tt.sink.TrackRequest(requestEvent{URL: "/api/v1/user"}); err == nil {
+				t.Error("expected the request to time out")
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("gave up after %s", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	// Beyond this, the oldest events are dropped (and counted).
+	maxQueuedEvents    = 1000
+	telemetryBatchSize = 50
+	// How long to wait for more events before sending a batch.
+	telemetrySendDelay = time.Second
+	maxSendBackoff     = time.Minute
+	// How long Flush lets a batch that's being sent finish.
+	// Anything unsent is spooled instead, so this stays short.
+	flushGrace = 200 * time.Millisecond
+)
+
+// Sinks that can send many events at once.
+type batchTracker interface {
+	TrackBatch([]requestEvent, []errorEvent) error
+}
+
+// Queues events in memory and sends them to remote in batches
+// from the background, so telemetry never slows a command down.
+// Whatever is left at exit is spooled to disk and sent next time.
+// Events may occasionally be sent twice, never blocked on.
+type BatchSink struct {
+	remote TelemetrySink
+	spool  telemetrySpool
+
+	mu      sync.Mutex
+	queue   []telemetryRecord
+	sending []telemetryRecord
+	dropped int
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	// Closed once whatever was spooled has been read back into queue.
+	loaded chan struct{}
+	once   sync.Once
+}
+
+func NewBatchSink(remote TelemetrySink, spool telemetrySpool) *BatchSink {
+	b := &BatchSink{
+		remote: remote,
+		spool:  spool,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		loaded: make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *BatchSink) TrackRequest(e requestEvent) error {
+	return b.enqueue(telemetryKindRequest, e)
+}
+
+func (b *BatchSink) TrackError(e errorEvent) error {
+	return b.enqueue(telemetryKindError, e)
+}
+
+func (b *BatchSink) enqueue(kind string, event any) error {
+	record, err := newTelemetryRecord(kind, event)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.queue = append(b.queue, record)
+	b.trim()
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Drop the oldest events over the limit. Must hold mu.
+func (b *BatchSink) trim() {
+	if over := len(b.queue) - maxQueuedEvents; over > 0 {
+		b.queue = b.queue[over:]
+		b.dropped += over
+	}
+}
+
+// Stop sending and spool whatever hasn't been sent.
+func (b *BatchSink) Flush() error {
+	var err error
+	b.once.Do(func() {
+		close(b.stop)
+		// Otherwise what run took from the spool would be lost.
+		<-b.loaded
+		select {
+		case <-b.done:
+		case <-time.After(flushGrace):
+		}
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		unsent := append(append([]telemetryRecord{}, b.sending...), b.queue...)
+		if len(unsent) == 0 && b.dropped == 0 {
+			return
+		}
+		// Telemetry was turned off while we ran; keep nothing for later.
+		if !loadTelemetrySettings().Enabled {
+			return
+		}
+		err = b.spool.Put(spooledTelemetry{Dropped: b.dropped, Events: unsent})
+	})
+	return err
+}
+
+func (b *BatchSink) run() {
+	defer close(b.done)
+
+	// Pick up where the last run left off. Take can wait on another
+	// process's lock, so don't hold mu (and block enqueue) meanwhile.
+	spooled, err := b.spool.Take()
+	if err == nil {
+		b.mu.Lock()
+		b.queue = append(spooled.Events, b.queue...)
+		b.dropped += spooled.Dropped
+		b.trim()
+		b.mu.Unlock()
+	} else {
+		lg.Println("Error reading telemetry spool:", err)
+	}
+	close(b.loaded)
+
+	backoff := telemetrySendDelay
+	for {
+		b.mu.Lock()
+		n := min(len(b.queue), telemetryBatchSize)
+		b.sending = b.queue[:n:n]
+		b.queue = b.queue[n:]
+		b.mu.Unlock()
+
+		if n == 0 {
+			select {
+			case <-b.stop:
+				return
+			case <-b.wake:
+			}
+			// Give the rest of a burst time to arrive.
+			select {
+			case <-b.stop:
+				return
+			case <-time.After(telemetrySendDelay):
+			}
+			continue
+		}
+
+		err := b.send(b.sending)
+
+		b.mu.Lock()
+		if err != nil {
+			lg.Println("Error sending telemetry:", err)
+			b.queue = append(b.sending, b.queue...)
+			b.trim()
+		}
+		b.sending = nil
+		b.mu.Unlock()
+
+		if err == nil {
+			backoff = telemetrySendDelay
+			continue
+		}
+		select {
+		case <-b.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxSendBackoff)
+	}
+}
+
+func (b *BatchSink) send(records []telemetryRecord) error {
+	var requests []requestEvent
+	var errs []errorEvent
+	for _, r := range records {
+		switch r.Kind {
+		case telemetryKindRequest:
+			var e requestEvent
+			if err := json.Unmarshal(r.Event, &e); err == nil {
+				requests = append(requests, e)
+			}
+		case telemetryKindError:
+			var e errorEvent
+			if err := json.Unmarshal(r.Event, &e); err == nil {
+				errs = append(errs, e)
+			}
+		}
+	}
+
+	if bt, ok := b.remote.(batchTracker); ok {
+		return bt.TrackBatch(requests, errs)
+	}
+	for _, e := range requests {
+		if err := b.remote.TrackRequest(e); err != nil {
+			return err
+		}
+	}
+	for _, e := range errs {
+		if err := b.remote.TrackError(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Events that haven't been sent yet, and how many we gave up on.
+type spooledTelemetry struct {
+	Dropped int               `json:"dropped"`
+	Events  []telemetryRecord `json:"events"`
+}
+
+// Kept in ~/.decanter/telemetry-spool.json, shared between processes.
+type telemetrySpool struct {
+	file string
+	lock string
+}
+
+func newTelemetrySpool() telemetrySpool {
+	dir := decanterDir()
+	os.MkdirAll(dir, 0755)
+	return telemetrySpool{
+		file: path.Join(dir, "telemetry-spool.json"),
+		lock: path.Join(dir, "telemetry-spool.lock"),
+	}
+}
+
+func (s telemetrySpool) Load() (spooledTelemetry, error) {
+	var spooled spooledTelemetry
+	b, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return spooled, nil
+	}
+	if err != nil {
+		return spooled, err
+	}
+	if err := json.Unmarshal(b, &spooled); err != nil {
+		return spooled, fmt.Errorf("telemetry spool is corrupt: %w", err)
+	}
+	return spooled, nil
+}
+
+// Load the spool and empty it.
+func (s telemetrySpool) Take() (spooledTelemetry, error) {
+	unlock, err := acquireLock(s.lock)
+	if err != nil {
+		return spooledTelemetry{}, err
+	}
+	defer unlock()
+
+	spooled, err := s.Load()
+	if err != nil {
+		// Don't keep tripping over a bad file.
+		os.Remove(s.file)
+		return spooledTelemetry{}, err
+	}
+	if err := os.Remove(s.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return spooledTelemetry{}, err
+	}
+	return spooled, nil
+}
+
+// Add to the spool, keeping at most maxQueuedEvents.
+func (s telemetrySpool) Put(add spooledTelemetry) error {
+	unlock, err := acquireLock(s.lock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	spooled, _ := s.Load()
+	spooled.Dropped += add.Dropped
+	spooled.Events = append(spooled.Events, add.Events...)
+	if over := len(spooled.Events) - maxQueuedEvents; over > 0 {
+		spooled.Events = spooled.Events[over:]
+		spooled.Dropped += over
+	}
+
+	b, err := json.Marshal(spooled)
+	if err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	// Private, like the settings.
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBatchSinkSpoolsUnsent(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   bool
+		wantSpool int
+	}{
+		{"kept for next time", true, 2},
+		{"thrown away once disabled", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			if err := setTelemetryEnabled(true); err != nil {
+				t.Fatal(err)
+			}
+			spool := newTelemetrySpool()
+			sink := NewBatchSink(failingSink{errors.New("offline")}, spool)
+			sink.TrackRequest(requestEvent{URL: "/api/v1/user"})
+			sink.TrackError(errorEvent{URL: "/api/v1/user", Code: 503})
+
+			// i.e. `decanter telemetry disable` in another terminal.
+			if err := setTelemetryEnabled(tt.enabled); err != nil {
+				t.Fatal(err)
+			}
+			if err := sink.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			spooled, err := spool.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(spooled.Events) != tt.wantSpool {
+				t.Errorf("spooled %d events, want %d", len(spooled.Events), tt.wantSpool)
+			}
+			if tt.wantSpool > 0 {
+				info, err := os.Stat(spool.file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if perm := info.Mode().Perm(); perm != 0600 {
+					t.Errorf("spool mode = %o, want 600", perm)
+				}
+			}
+		})
+	}
+}
+
+// Another process holding the spool lock mustn't hold up tracking,
+// and what's spooled is still picked up once the lock is free.
+func TestBatchSinkDoesNotBlockOnSpool(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := setTelemetryEnabled(true); err != nil {
+		t.Fatal(err)
+	}
+	spool := newTelemetrySpool()
+	earlier, _ := newTelemetryRecord(telemetryKindRequest, requestEvent{URL: "/api/v1/courses"})
+	if err := spool.Put(spooledTelemetry{Events: []telemetryRecord{earlier}}); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := acquireLock(spool.lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := NewBatchSink(failingSink{errors.New("offline")}, spool)
+	// Give it time to start waiting on the lock.
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	sink.TrackRequest(requestEvent{URL: "/api/v1/user"})
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("tracking waited %s on the spool lock", elapsed)
+	}
+
+	time.AfterFunc(300*time.Millisecond, unlock)
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	spooled, err := spool.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spooled.Events) != 2 {
+		t.Errorf("spooled %d events, want the earlier one and the new one", len(spooled.Events))
+	}
+}
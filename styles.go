@@ -8,6 +8,7 @@ import (
 var (
 	colorPrimary = lipgloss.Color("124")
 	colorSpecial = lipgloss.AdaptiveColor{Light: "#43BF6D", Dark: "#73F59F"}
+	colorWarning = lipgloss.Color("214")
 
 	url = lipgloss.NewStyle().
 		Foreground(colorSpecial).
@@ -19,6 +20,10 @@ var (
 			PaddingRight(1).
 			String()
 
+	bestMark = lipgloss.NewStyle().SetString("★").
+			Foreground(colorSpecial).
+			String()
+
 	finished = func(s string) string {
 		sty := lipgloss.NewStyle().MarginLeft(0)
 		return sty.Render(checkMark + s)
@@ -29,6 +34,11 @@ var (
 		return sty.Render("ERROR: ") + s
 	}
 
+	warningMsg = func(s string) string {
+		sty := lipgloss.NewStyle().Foreground(colorWarning)
+		return sty.Render("WARNING: ") + s
+	}
+
 	emph = func(s string) string {
 		return lipgloss.NewStyle().Foreground(colorPrimary).Render(s)
 	}
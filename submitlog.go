@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+// Every upload is recorded (with a hash of the file) before it starts.
+// If it gets interrupted, the next `submit` of the same file can check
+// whether it went through instead of burning another submission.
+type submitRecord struct {
+	Course     string    `json:"course"`
+	Assessment string    `json:"assessment"`
+	File       string    `json:"file"`
+	Hash       string    `json:"sha256"`
+	StartedAt  time.Time `json:"started_at"`
+	// 0 until Autolab confirms the upload.
+	Version int `json:"version"`
+}
+
+const (
+	// How long an unconfirmed upload is worth checking for.
+	pendingWindow = 10 * time.Minute
+	// Records are only kept around to spot duplicate submissions.
+	submitRetention = 180 * 24 * time.Hour
+)
+
+func (r submitRecord) pending() bool {
+	return r.Version == 0 && time.Since(r.StartedAt) < pendingWindow
+}
+
+func (r submitRecord) matches(course, assessment, hash string) bool {
+	return r.Course == course && r.Assessment == assessment && r.Hash == hash
+}
+
+// Kept in ~/.decanter/submits.json, locked like the queue.
+type submitLog struct {
+	file string
+	lock string
+}
+
+func newSubmitLog() submitLog {
+	dir := decanterDir()
+	os.MkdirAll(dir, 0755)
+	return submitLog{
+		file: path.Join(dir, "submits.json"),
+		lock: path.Join(dir, "submits.lock"),
+	}
+}
+
+func (l submitLog) Load() ([]submitRecord, error) {
+	b, err := os.ReadFile(l.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []submitRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (l submitLog) update(f func([]submitRecord) []submitRecord) error {
+	unlock, err := acquireLock(l.lock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	records, err := l.Load()
+	if err != nil {
+		return err
+	}
+	records = f(records)
+
+	var kept []submitRecord
+	for _, r := range records {
+		if r.Version > 0 && time.Since(r.StartedAt) < submitRetention || r.pending() {
+			kept = append(kept, r)
+		}
+	}
+
+	b, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.file)
+}
+
+// Replace the record for the same upload, if there is one.
+func (l submitLog) Put(record submitRecord) error {
+	return l.update(func(records []submitRecord) []submitRecord {
+		for i, r := range records {
+			if r.matches(record.Course, record.Assessment, record.Hash) && r.StartedAt.Equal(record.StartedAt) {
+				records[i] = record
+				return records
+			}
+		}
+		return append(records, record)
+	})
+}
+
+func (l submitLog) Remove(record submitRecord) error {
+	return l.update(func(records []submitRecord) []submitRecord {
+		var kept []submitRecord
+		for _, r := range records {
+			if !(r.matches(record.Course, record.Assessment, record.Hash) && r.StartedAt.Equal(record.StartedAt)) {
+				kept = append(kept, r)
+			}
+		}
+		return kept
+	})
+}
+
+// The latest confirmed version with exactly this content, or 0.
+func (l submitLog) previousVersion(course, assessment, hash string) int {
+	records, _ := l.Load()
+	var version int
+	for _, r := range records {
+		if r.matches(course, assessment, hash) {
+			version = max(version, r.Version)
+		}
+	}
+	return version
+}
+
+// The most recent upload of this content that never heard back.
+func (l submitLog) pendingUpload(course, assessment, hash string) (submitRecord, bool) {
+	records, _ := l.Load()
+	var found submitRecord
+	var ok bool
+	for _, r := range records {
+		if r.matches(course, assessment, hash) && r.pending() && r.StartedAt.After(found.StartedAt) {
+			found, ok = r, true
+		}
+	}
+	return found, ok
+}
+
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Submit file, unless an earlier interrupted upload of the same
+// content already made it to Autolab (then Recovered is set).
+func (d Decanter) submit(course, assessment, file, hash string, opts Autolab.SubmitOptions) (submitOutput, error) {
+	result := submitOutput{Course: course, Assessment: assessment, File: file}
+	submits := newSubmitLog()
+
+	if pending, ok := submits.pendingUpload(course, assessment, hash); ok {
+		submissions, err := d.GetSubmissions(course, assessment)
+		if err != nil {
+			return result, err
+		}
+		if sub, ok := Autolab.FindUpload(submissions, file, pending.StartedAt); ok {
+			pending.Version = sub.Version
+			submits.Put(pending)
+			result.SubmitResponse = Autolab.SubmitResponse{Version: sub.Version, Filename: sub.Filename}
+			result.Recovered = true
+			return result, nil
+		}
+		// It never arrived, so uploading again is safe.
+		submits.Remove(pending)
+	}
+
+	record := submitRecord{
+		Course:     course,
+		Assessment: assessment,
+		File:       file,
+		Hash:       hash,
+		StartedAt:  time.Now(),
+	}
+	if err := submits.Put(record); err != nil {
+		return result, err
+	}
+
+	var err error
+	result.SubmitResponse, err = d.SubmitFile(course, assessment, file, opts)
+	var statusErr *Autolab.StatusError
+	switch {
+	case errors.Is(err, Autolab.ErrSubmitUnconfirmed):
+		// Leave the record pending; the next submit will check.
+	case errors.As(err, &statusErr):
+		// Autolab turned it down, so nothing was created.
+		submits.Remove(record)
+	case err != nil:
+		// i.e. the connection dropped; leave it pending too.
+	default:
+		record.Version = result.Version
+		submits.Put(record)
+	}
+	return result, err
+}
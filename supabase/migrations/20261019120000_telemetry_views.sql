@@ -0,0 +1,136 @@
+-- Bring the schema in line with what the client sends (see TELEMETRY.md):
+--   requests: url, size
+--   errors:   url, status, code, error
+-- and add views for the dashboard.
+
+comment on table "public"."requests" is 'One row per request to Autolab. Course and assessment names in url are salted hashes.';
+comment on table "public"."errors" is 'One row per failed request to Autolab. code is 0 if there was no response.';
+
+-- Errors are write only for clients, like requests.
+create policy "No selects"
+on "public"."errors"
+as permissive
+for select
+to anon
+using (false);
+
+create policy "No updates"
+on "public"."errors"
+as permissive
+for update
+to anon
+using (false)
+with check (false);
+
+create policy "Disable deletes"
+on "public"."errors"
+as permissive
+for delete
+to anon
+using (false);
+
+-- The client no longer sends raw course and assessment names.
+-- Keep what's there, but stop accepting more.
+-- ("No deletes" allowed deletes, so that goes too.)
+drop policy "anon can insert" on "public"."courses_assessments";
+drop policy "No deletes" on "public"."courses_assessments";
+
+create index requests_created_at_idx on public.requests using btree (created_at);
+create index errors_created_at_idx on public.errors using btree (created_at);
+
+-- The url with hashed names replaced by placeholders, i.e.
+--   /api/v1/courses/3f2a9c1d0b7e/assessments/9a8b7c6d5e4f/submissions
+--   => /api/v1/courses/:course/assessments/:assessment/submissions
+-- Matches the segments the client hashes (scrub.go).
+create or replace function public.telemetry_endpoint(url text)
+returns text
+language sql
+immutable
+as $$
+    select regexp_replace(
+        regexp_replace(
+            regexp_replace(url, '/courses/[^/]+', '/courses/:course'),
+            '/assessments/[^/]+', '/assessments/:assessment'),
+        '/(submissions|problems)/[^/]+', '/\1/:id', 'g')
+$$;
+
+-- The hashed course in url, if there is one.
+create or replace function public.telemetry_course(url text)
+returns text
+language sql
+immutable
+as $$
+    select substring(url from '/courses/([^/]+)')
+$$;
+
+-- Views run as the caller (so RLS still applies), and are only
+-- for the dashboard, not the anon key the client uses.
+
+create view public.requests_per_day
+with (security_invoker = true)
+as
+with reqs as (
+    select date_trunc('day', created_at)::date as day, count(*) as requests, sum(size) as bytes
+    from public.requests
+    group by 1
+), errs as (
+    select date_trunc('day', created_at)::date as day, count(*) as errors
+    from public.errors
+    group by 1
+)
+select
+    coalesce(reqs.day, errs.day) as day,
+    coalesce(reqs.requests, 0) as requests,
+    coalesce(reqs.bytes, 0) as bytes,
+    coalesce(errs.errors, 0) as errors
+from reqs
+full outer join errs on reqs.day = errs.day
+order by 1;
+
+create view public.error_rate_per_endpoint
+with (security_invoker = true)
+as
+with reqs as (
+    select public.telemetry_endpoint(url) as endpoint, count(*) as requests
+    from public.requests
+    group by 1
+), errs as (
+    select
+        public.telemetry_endpoint(url) as endpoint,
+        count(*) as errors,
+        count(*) filter (where code = 0) as network_errors,
+        count(*) filter (where code >= 500) as server_errors
+    from public.errors
+    group by 1
+)
+select
+    coalesce(reqs.endpoint, errs.endpoint) as endpoint,
+    coalesce(reqs.requests, 0) as requests,
+    coalesce(errs.errors, 0) as errors,
+    coalesce(errs.network_errors, 0) as network_errors,
+    coalesce(errs.server_errors, 0) as server_errors,
+    round(coalesce(errs.errors, 0)::numeric / nullif(reqs.requests, 0), 4) as error_rate
+from reqs
+full outer join errs on reqs.endpoint = errs.endpoint
+order by error_rate desc nulls last, requests desc;
+
+-- Courses seen in the last 30 days, by their hash.
+create view public.active_courses
+with (security_invoker = true)
+as
+select
+    public.telemetry_course(url) as course,
+    count(*) as requests,
+    count(*) filter (where url like '%/submit') as submissions,
+    count(*) filter (where created_at > now() - interval '7 days') as requests_last_7_days,
+    min(created_at) as first_seen,
+    max(created_at) as last_seen
+from public.requests
+where created_at > now() - interval '30 days'
+  and public.telemetry_course(url) is not null
+group by 1
+order by requests desc;
+
+revoke all on public.requests_per_day from anon, authenticated;
+revoke all on public.error_rate_per_endpoint from anon, authenticated;
+revoke all on public.active_courses from anon, authenticated;
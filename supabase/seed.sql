@@ -0,0 +1,103 @@
+-- Made-up telemetry for working on the dashboard locally
+-- (`supabase start` or `supabase db reset` loads this).
+--
+-- A month of traffic from a dozen courses with a few assessments
+-- each, shaped like the real thing: quiet at night, busy in the
+-- two days before a deadline, and Autolab falling over in the
+-- last few hours. Names are hashed like the client does (scrub.go).
+
+select setseed(0.42);
+
+create temporary table seed_assessments as
+select
+    substr(md5('course-' || c), 1, 12) as course,
+    substr(md5('assessment-' || c || '-' || a), 1, 12) as assessment,
+    -- Due at 23:59, anywhere from three weeks ago to next week.
+    date_trunc('day', now() - interval '22 days' + interval '27 days' * random())
+        + interval '23 hours 59 minutes' as due
+from generate_series(1, 12) as c, generate_series(1, 4) as a;
+
+create temporary table seed_requests as
+with visits as (
+    -- The rush, bunched up towards the deadline.
+    select course, assessment, due, due - interval '48 hours' * power(random(), 3) as created_at
+    from seed_assessments, generate_series(1, 150)
+    union all
+    -- Everything else, during the day.
+    select course, assessment, due,
+        date_trunc('day', now() - interval '30 days' * random())
+            + interval '9 hours' + interval '14 hours' * random() as created_at
+    from seed_assessments, generate_series(1, 40)
+), picked as (
+    select *, random() as r
+    from visits
+    where created_at <= now()
+)
+select
+    created_at,
+    due,
+    case
+        when r < 0.45 then '/api/v1/courses/' || course || '/assessments/' || assessment || '/submissions'
+        when r < 0.60 then '/api/v1/courses/' || course || '/assessments'
+        when r < 0.70 then '/api/v1/courses'
+        when r < 0.75 then '/api/v1/user'
+        when r < 0.92 then '/api/v1/courses/' || course || '/assessments/' || assessment || '/submit'
+        else '/api/v1/courses/' || course || '/assessments/' || assessment || '/problems'
+    end as url
+from picked;
+
+insert into public.requests (created_at, url, size)
+select
+    created_at,
+    url,
+    -- Handins are mostly small, with the odd zip of everything.
+    case when url like '%/submit' then (2000 + 200000 * power(random(), 4))::bigint else 0 end
+from seed_requests;
+
+-- Most students can't see problems, and the last
+-- few hours before a deadline are rough.
+with failed as (
+    select created_at, url, case
+        when url like '%/problems' and e < 0.85 then 403
+        when rush and e < 0.06 then 502
+        when rush and e < 0.09 then 503
+        when rush and e < 0.12 then 504
+        when rush and e < 0.13 then 429
+        when rush and e < 0.15 then 0
+        when e < 0.005 then 0
+        when e < 0.010 then 500
+        when e < 0.012 then 401
+    end as code
+    from (
+        select *, random() as e, created_at > due - interval '3 hours' as rush
+        from seed_requests
+    ) as requests
+)
+insert into public.errors (created_at, url, status, code, error)
+select
+    created_at + interval '1 second' * random(),
+    url,
+    case code
+        when 0 then ''
+        when 401 then 'Unauthorized'
+        when 403 then 'Forbidden'
+        when 429 then 'Too Many Requests'
+        when 500 then 'Internal Server Error'
+        when 502 then 'Bad Gateway'
+        when 503 then 'Service Unavailable'
+        when 504 then 'Gateway Timeout'
+    end,
+    code,
+    case
+        when code <> 0 then ''
+        else (array[
+            'Get: dial tcp: i/o timeout',
+            'Get: read tcp: connection reset by peer',
+            'Get: dial tcp: connect: connection refused'
+        ])[1 + floor(random() * 3)::int]
+    end
+from failed
+where code is not null;
+
+drop table seed_requests;
+drop table seed_assessments;
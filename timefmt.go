@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/p5quared/decanter/Autolab"
+)
+
+// Every time we show goes through here, so they all
+// respect the configured timezone and --time-style.
+type timeStyle string
+
+const (
+	timeAbsolute timeStyle = "absolute" // Mon Feb 5 3:04PM
+	timeRelative timeStyle = "relative" // in 2d 4h
+	timeISO      timeStyle = "iso"      // 2024-02-05T15:04:05-05:00
+)
+
+// Set from the config / flags in main.
+var (
+	displayStyle    = timeAbsolute
+	displayLocation = time.Local
+)
+
+func parseTimeStyle(s string) (timeStyle, error) {
+	switch st := timeStyle(s); st {
+	case timeAbsolute, timeRelative, timeISO:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown time style %q (options: absolute|relative|iso)", s)
+}
+
+// Set up the display timezone; empty means local time.
+func setDisplayLocation(name string) error {
+	if name == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	displayLocation = loc
+	return nil
+}
+
+// Parse an Autolab time in the display timezone.
+// An empty time isn't an error (not every assessment has every date);
+// it's returned as the zero time, so check IsZero.
+func autolabTime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	t, err := Autolab.ParseTime(raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(displayLocation), nil
+}
+
+func formatTime(t time.Time) string {
+	return formatTimeAs(displayStyle, t)
+}
+
+func formatTimeAs(style timeStyle, t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	t = t.In(displayLocation)
+	switch style {
+	case timeRelative:
+		return formatRelative(t)
+	case timeISO:
+		return t.Format(time.RFC3339)
+	default:
+		return t.Format("Mon Jan 2 3:04PM")
+	}
+}
+
+// Shorthand for times straight from Autolab.
+// Shows what Autolab sent if we can't make sense of it.
+func formatRawTime(raw string) string {
+	t, err := autolabTime(raw)
+	if err != nil {
+		return raw
+	}
+	return formatTime(t)
+}
+
+// "in 2d 4h", "in 35m", "3h ago", "<1m ago"
+func formatRelative(t time.Time) string {
+	d := time.Until(t)
+	suffix := func(s string) string { return "in " + s }
+	if d < 0 {
+		d = -d
+		suffix = func(s string) string { return s + " ago" }
+	}
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	switch {
+	case days > 0:
+		return suffix(fmt.Sprintf("%dd %dh", days, hours))
+	case hours > 0:
+		return suffix(fmt.Sprintf("%dh %dm", hours, minutes))
+	case minutes == 0:
+		return suffix("<1m")
+	default:
+		return suffix(fmt.Sprintf("%dm", minutes))
+	}
+}
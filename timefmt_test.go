@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatRelative(t *testing.T) {
+	// Half a minute of slack either way, so the clock ticking
+	// between here and formatRelative doesn't change the answer.
+	const slack = 30 * time.Second
+	tests := []struct {
+		name string
+		in   time.Duration
+		want string
+	}{
+		{"under a minute away", slack, "in <1m"},
+		{"under a minute ago", -slack, "<1m ago"},
+		{"a minute away", time.Minute + slack, "in 1m"},
+		{"a minute ago", -time.Minute - slack, "1m ago"},
+		{"under an hour", 59*time.Minute + slack, "in 59m"},
+		{"an hour", time.Hour + slack, "in 1h 0m"},
+		{"hours ago", -3*time.Hour - 5*time.Minute - slack, "3h 5m ago"},
+		{"under a day", 23*time.Hour + 59*time.Minute + slack, "in 23h 59m"},
+		{"a day", 24*time.Hour + slack, "in 1d 0h"},
+		{"days", 2*24*time.Hour + 4*time.Hour + slack, "in 2d 4h"},
+		{"days ago", -9*24*time.Hour - slack, "9d 0h ago"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatRelative(time.Now().Add(tt.in)); got != tt.want {
+				t.Errorf("formatRelative(now%+v) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTimeAs(t *testing.T) {
+	defer func(loc *time.Location) { displayLocation = loc }(displayLocation)
+	displayLocation = time.FixedZone("EST", -5*60*60)
+
+	due := time.Date(2024, time.March, 2, 4, 59, 0, 0, time.UTC)
+	tests := []struct {
+		style timeStyle
+		in    time.Time
+		want  string
+	}{
+		{timeAbsolute, due, "Fri Mar 1 11:59PM"},
+		{timeISO, due, "2024-03-01T23:59:00-05:00"},
+		{timeAbsolute, time.Time{}, "-"},
+		{timeRelative, time.Time{}, "-"},
+		{timeISO, time.Time{}, "-"},
+	}
+	for _, tt := range tests {
+		if got := formatTimeAs(tt.style, tt.in); got != tt.want {
+			t.Errorf("formatTimeAs(%s, %s) = %q, want %q", tt.style, tt.in, got, tt.want)
+		}
+	}
+	if got := formatTimeAs(timeRelative, time.Now().Add(-2*time.Hour-30*time.Second)); got != "2h 0m ago" {
+		t.Errorf("formatTimeAs(relative, 2h ago) = %q, want %q", got, "2h 0m ago")
+	}
+}
+
+func TestFormatRawTime(t *testing.T) {
+	defer func(loc *time.Location, style timeStyle) { displayLocation, displayStyle = loc, style }(displayLocation, displayStyle)
+	displayLocation, displayStyle = time.UTC, timeISO
+
+	tests := []struct {
+		in, want string
+	}{
+		{"2024-03-01T23:59:00.000-05:00", "2024-03-02T04:59:00Z"},
+		{"", "-"},
+		// Shown as sent rather than dropped.
+		{"next friday", "next friday"},
+	}
+	for _, tt := range tests {
+		if got := formatRawTime(tt.in); got != tt.want {
+			t.Errorf("formatRawTime(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
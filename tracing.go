@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"golang.org/x/oauth2"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Tracing is for seeing where the time goes, i.e.
+//
+//	[tracing]
+//	exporter = "otlp" # to a local collector
+//
+// It's separate from telemetry: traces only go where you send them.
+type TracingConfig struct {
+	// otlp|file, off if empty.
+	Exporter string `toml:"exporter"`
+	// OTLP/HTTP collector URL, i.e. http://localhost:4318; https unless
+	// it says otherwise. Defaults to $OTEL_EXPORTER_OTLP_ENDPOINT, or localhost:4318.
+	Endpoint string `toml:"endpoint"`
+	// Where file appends OTLP-JSON, one request per line (default: ~/.decanter/traces.jsonl).
+	File string `toml:"file"`
+}
+
+var tracer = otel.Tracer("github.com/p5quared/decanter")
+
+// Context of the command being run. Autolab calls don't take a context,
+// so this is what their spans hang off.
+var commandCtx = context.Background()
+
+// Install a tracer provider for conf. Call the returned
+// function before exiting to send any spans still buffered.
+func setupTracing(conf TracingConfig) (func(), error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch conf.Exporter {
+	case "":
+		return func() {}, nil
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if conf.Endpoint != "" {
+			// WithEndpointURL picks TLS from the scheme.
+			opts = append(opts, otlptracehttp.WithEndpointURL(otlpTracesURL(conf.Endpoint)))
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	case "file":
+		file := conf.File
+		if file == "" {
+			file = path.Join(decanterDir(), "traces.jsonl")
+		}
+		exporter, err = otlptrace.New(context.Background(), &otlpFileClient{file: file})
+	default:
+		return func() {}, fmt.Errorf("unknown tracing exporter %q, expected otlp|file", conf.Exporter)
+	}
+	if err != nil {
+		return func() {}, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("decanter"))),
+	)
+	otel.SetTracerProvider(tp)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			printError("Could not export traces.\n" + err.Error())
+		}
+	}, nil
+}
+
+// Like $OTEL_EXPORTER_OTLP_ENDPOINT, endpoint is the collector's base
+// URL, so traces go to /v1/traces unless it has a path of its own.
+// Without a scheme it's https; only say http if you mean it.
+func otlpTracesURL(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := neturl.Parse(endpoint)
+	if err != nil {
+		// Let the exporter complain.
+		return endpoint
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return u.String()
+}
+
+// Start the root span for a command; everything else is a child of it.
+// Only the command names it: the rest of args can be file paths or courses.
+func startCommandSpan(args []string, attrs ...attribute.KeyValue) func() {
+	var span trace.Span
+	commandCtx, span = tracer.Start(context.Background(), args[0],
+		trace.WithAttributes(append(attrs, attribute.String("decanter.command", args[0]))...))
+	return func() { span.End() }
+}
+
+// Run f in a span under the command's.
+func inSpan(name string, f func() error) error {
+	_, span := tracer.Start(commandCtx, name)
+	defer span.End()
+	err := f()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// A span per Autolab request, including time spent retrying
+// and waiting on the rate limiter, so this goes first.
+func Tracing() Layer {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				ctx = commandCtx
+			}
+			// Paths have course names in them, so they make poor span names.
+			ctx, span := tracer.Start(ctx, req.Method,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.URLPath(req.URL.Path),
+					semconv.ServerAddress(req.URL.Hostname()),
+				))
+			defer span.End()
+
+			resp, err := next.RoundTrip(req.WithContext(ctx))
+			switch {
+			case err != nil:
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			case resp.StatusCode >= 400:
+				span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+				span.SetStatus(codes.Error, resp.Status)
+			default:
+				span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+			}
+			return resp, err
+		})
+	}
+}
+
+// Spans for the times the token actually has to be loaded or
+// refreshed; oauth2.ReuseTokenSource only calls us then.
+type tracedTokenSource struct {
+	src oauth2.TokenSource
+}
+
+func (t tracedTokenSource) Token() (*oauth2.Token, error) {
+	_, span := tracer.Start(commandCtx, "oauth2 token")
+	defer span.End()
+	token, err := t.src.Token()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return token, err
+}
+
+// Writes spans to a file in the OTLP-JSON format,
+// as the collector's file exporter does.
+type otlpFileClient struct {
+	file string
+	mu   sync.Mutex
+}
+
+func (c *otlpFileClient) Start(context.Context) error { return nil }
+func (c *otlpFileClient) Stop(context.Context) error  { return nil }
+
+func (c *otlpFileClient) UploadTraces(_ context.Context, spans []*tracepb.ResourceSpans) error {
+	b, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(&tracepb.TracesData{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+	b, err = hexIDs(b)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := os.OpenFile(c.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// protojson writes bytes as base64, but OTLP-JSON wants IDs in hex.
+func hexIDs(b []byte) ([]byte, error) {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	var walk func(any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, val := range v {
+				if s, ok := val.(string); ok && (k == "traceId" || k == "spanId" || k == "parentSpanId") {
+					if raw, err := base64.StdEncoding.DecodeString(s); err == nil {
+						v[k] = hex.EncodeToString(raw)
+					}
+					continue
+				}
+				walk(val)
+			}
+		case []any:
+			for _, val := range v {
+				walk(val)
+			}
+		}
+	}
+	walk(v)
+	return json.Marshal(v)
+}
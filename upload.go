@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/p5quared/decanter/Autolab"
+)
+
+// Progress bar for Autolab.SubmitFile, with bytes sent, rate and ETA.
+type uploadModel struct {
+	bar         progress.Model
+	title       string
+	sent, total int64
+	start       time.Time
+	interrupted bool
+}
+
+type uploadProgressMsg struct{ sent, total int64 }
+
+type uploadDoneMsg struct{}
+
+func (m uploadModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m uploadModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case uploadProgressMsg:
+		if msg.sent < m.sent {
+			// The upload was retried.
+			m.start = time.Now()
+		}
+		m.sent, m.total = msg.sent, msg.total
+	case uploadDoneMsg:
+		return m, tea.Quit
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			m.interrupted = true
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m uploadModel) View() string {
+	if m.total <= 0 {
+		return fmt.Sprintf(" %s %s", m.title, formatBytes(m.sent))
+	}
+
+	percent := float64(m.sent) / float64(m.total)
+	info := fmt.Sprintf("%s / %s", formatBytes(m.sent), formatBytes(m.total))
+	elapsed := time.Since(m.start).Seconds()
+	if m.sent > 0 && elapsed > 0 {
+		rate := float64(m.sent) / elapsed
+		eta := time.Duration(float64(m.total-m.sent) / rate * float64(time.Second))
+		info += fmt.Sprintf(", %s/s, %s left", formatBytes(int64(rate)), eta.Round(time.Second))
+	}
+	return fmt.Sprintf(" %s\n %s %s\n", m.title, m.bar.ViewAs(percent), info)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Returned by withUploadProgress if the user hit ctrl+c.
+var errUploadInterrupted = errors.New("upload interrupted")
+
+// Run upload behind a progress bar.
+// There's no way to stop an upload part way, so on ctrl+c this returns
+// errUploadInterrupted straight away, with upload still running;
+// don't touch anything it writes to after that.
+func withUploadProgress(title string, upload func(opts Autolab.SubmitOptions)) error {
+	if structuredOutput() || !isTTY {
+		upload(Autolab.SubmitOptions{})
+		return nil
+	}
+
+	p := tea.NewProgram(uploadModel{
+		bar:   progress.New(progress.WithSolidFill(string(colorPrimary)), progress.WithWidth(40)),
+		title: title,
+		total: -1,
+		start: time.Now(),
+	}, tea.WithOutput(os.Stderr))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		upload(Autolab.SubmitOptions{
+			OnProgress: func(sent, total int64) { p.Send(uploadProgressMsg{sent, total}) },
+		})
+		p.Send(uploadDoneMsg{})
+	}()
+	m, _ := p.Run()
+	if m, ok := m.(uploadModel); ok && m.interrupted {
+		return errUploadInterrupted
+	}
+	// Even if the progress bar failed, the upload carries on.
+	<-done
+	return nil
+}
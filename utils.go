@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"net/http"
 	"time"
 
@@ -17,17 +16,26 @@ type Decanter struct {
 	auth Autolab.AutolabOAuthClient
 	ts   Autolab.TokenStore
 	host string
+	conf Config
 }
 
-func NewDecanter() Decanter {
+func NewDecanter(conf Config) Decanter {
 	fs := NewFileTokenStore("auth.json")
 	ac := Autolab.NewAuthClient(decanterClientID, decanterClientSecret, host)
 
-	ts := Autolab.NewTokenSource(fs, ac)
-	oauth2Client := oauth2.NewClient(context.Background(), ts)
-	autolabClient := Autolab.NewAutolab(oauth2Client)
+	layers := []Layer{
+		Tracing(),
+		Retry(defaultRetryOptions),
+		RateLimit(5, 10),
+	}
+	layers = append(layers, WithTelemetry(conf.Telemetry)...)
+	if httpRecorder != nil {
+		// Last, so each retry is recorded as it went over the wire.
+		layers = append(layers, httpRecorder.Layer())
+	}
+	autolabClient := Autolab.NewAutolab(newAutolabHTTPClient(ac, fs, layers...))
 
-	return Decanter{autolabClient, ac, fs, host}
+	return Decanter{autolabClient, ac, fs, host, conf}
 }
 
 func filter[T any](elements []T, p func(T) bool) []T {
@@ -77,11 +85,15 @@ func (d Decanter) tokenExists() bool {
 	return true
 }
 
-func newAutolabHTTPClient(authClient Autolab.AutolabOAuthClient, fs Autolab.TokenStore) *http.Client {
+// Same as oauth2.NewClient, but requests go through layers
+// once they're authorized, on their way to the network.
+func newAutolabHTTPClient(authClient Autolab.AutolabOAuthClient, fs Autolab.TokenStore, layers ...Layer) *http.Client {
 	ts := Autolab.NewTokenSource(fs, authClient)
 
-	oauth2Client := oauth2.NewClient(context.Background(), ts)
-	// oauth2Client.Transport = WithTelemetry(oauth2Client)
-
-	return oauth2Client
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Base:   Chain(http.DefaultTransport, layers...),
+			Source: oauth2.ReuseTokenSource(nil, tracedTokenSource{ts}),
+		},
+	}
 }
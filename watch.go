@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/p5quared/decanter/Autolab"
+)
+
+// Spinner for Autolab.WatchSubmission.
+// Unlike huh's spinner, the title follows the watcher's state
+// and shows how long we've been waiting.
+type watchModel struct {
+	spinner spinner.Model
+	title   string
+	state   Autolab.WatchState
+	start   time.Time
+	cancel  context.CancelFunc
+}
+
+type watchDoneMsg struct{}
+
+func (m watchModel) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+func (m watchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case Autolab.WatchUpdate:
+		m.state = msg.State
+		return m, nil
+	case watchDoneMsg:
+		return m, tea.Quit
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			m.cancel()
+			return m, tea.Quit
+		}
+	}
+	var cmd tea.Cmd
+	m.spinner, cmd = m.spinner.Update(msg)
+	return m, cmd
+}
+
+func (m watchModel) View() string {
+	elapsed := time.Since(m.start).Truncate(time.Second)
+	return fmt.Sprintf("%s%s (%s, %s)", m.spinner.View(), m.title, watchStateStyle(m.state.String()).Render(m.state.String()), elapsed)
+}
+
+func watchStateStyle(state string) lipgloss.Style {
+	if state == Autolab.WatchGraded.String() {
+		return lipgloss.NewStyle().Foreground(colorSpecial)
+	}
+	return lipgloss.NewStyle().Foreground(colorPrimary)
+}
+
+// Run watch behind a spinner that tracks its progress.
+// The context passed to watch is cancelled if the user hits ctrl+c.
+func withWatchSpinner(title string, watch func(ctx context.Context, onUpdate func(Autolab.WatchUpdate))) {
+	ctx, cancel := context.WithCancel(commandCtx)
+	defer cancel()
+
+	if structuredOutput() || !isTTY {
+		watch(ctx, nil)
+		return
+	}
+
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = spinStyle
+
+	p := tea.NewProgram(watchModel{
+		spinner: s,
+		title:   title,
+		start:   time.Now(),
+		cancel:  cancel,
+	}, tea.WithOutput(os.Stderr))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watch(ctx, func(u Autolab.WatchUpdate) { p.Send(u) })
+		p.Send(watchDoneMsg{})
+	}()
+	p.Run()
+	// If the user quit early, wait for watch to see the cancellation.
+	<-done
+}
+
+// Wait for result's version to be graded, then show it
+// along with how it compares to the previous version.
+func (d Decanter) watchAndShow(result submitOutput, timeout time.Duration, notify bool) {
+	var err error
+	title := fmt.Sprintf("Waiting for grading of version %d", result.Version)
+	withWatchSpinner(title, func(ctx context.Context, onUpdate func(Autolab.WatchUpdate)) {
+		opts := Autolab.WatchOptions{Timeout: timeout, OnUpdate: onUpdate}
+		var graded Autolab.SubmissionsResponse
+		graded, err = d.WatchSubmission(ctx, result.Course, result.Assessment, result.Version, opts)
+		if err == nil {
+			result = d.completeResult(result, graded)
+		}
+	})
+	if errors.Is(err, Autolab.ErrWatchTimeout) {
+		printError(fmt.Sprintf("Gave up waiting for grading.\n%s\nTry 'decanter watch' again later.", err.Error()))
+		return
+	}
+	if err != nil {
+		errStr := fmt.Sprintf("Something went wrong while waiting for grading.\n%s", err.Error())
+		printError(errStr)
+		return
+	}
+	status("Submission graded")
+
+	show(result, func() {
+		displaySubmission(fmt.Sprintf("Submission (Version %d)", result.Version), *result.Graded)
+		if result.Diff != nil {
+			displayScoreDiff(*result.Diff)
+		}
+	})
+	if notify {
+		d.notify(result)
+	}
+}
+
+// Fill in the graded submission, its totals and the diff against the previous version.
+func (d Decanter) completeResult(result submitOutput, graded Autolab.SubmissionsResponse) submitOutput {
+	maxScores := d.maxScores(result.Course, result.Assessment)
+	// Only needed for the diff, so it's fine if this fails.
+	submissions, _ := d.GetSubmissions(result.Course, result.Assessment)
+
+	out := newSubmissionOutput(graded).withMax(maxScores)
+	result.Filename = graded.Filename
+	result.Graded = &out
+	if prev, ok := previousSubmission(submissions, graded.Version); ok {
+		diff := diffSubmissions(prev, graded)
+		result.Diff = &diff
+	}
+	return result
+}